@@ -5,57 +5,88 @@ import (
 	"flag"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
-	"github.com/joho/godotenv"
-	"go.temporal.io/sdk/client"
-	"log"
-	"time"
 	"go-temporal-workflow/api/handlers"
+	"go-temporal-workflow/bus"
+	"go-temporal-workflow/bus/amqpbus"
+	"go-temporal-workflow/bus/memory"
+	"go-temporal-workflow/config"
 	"go-temporal-workflow/db"
+	"go-temporal-workflow/lifecycle"
+	"go-temporal-workflow/logging"
+	"go-temporal-workflow/outbox"
 	"go-temporal-workflow/rmq"
+	"go-temporal-workflow/security/lockout"
+	"go-temporal-workflow/security/passwords"
+	"go-temporal-workflow/security/secrets"
+	"go-temporal-workflow/security/tokens"
+	"go-temporal-workflow/services/accounts"
+	"go-temporal-workflow/services/admin"
+	"go-temporal-workflow/services/commands"
 	"go-temporal-workflow/services/subscriptions"
 	"go-temporal-workflow/services/users"
 	"go-temporal-workflow/store"
+	"go-temporal-workflow/temporalclient"
 	"go-temporal-workflow/utils"
+	"log"
+	"os"
+	"time"
 )
 
-var port int
-
-func init() {
-	err := godotenv.Load(utils.GetEnvFilePath())
+func Run() {
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:], utils.GetEnvFilePath())
 	if err != nil {
 		log.Panicln(err)
 	}
-	flag.IntVar(&port, "api_port", 8080, "set api port")
-	db.LoadConfigFromFlags(flag.CommandLine)
-	rmq.LoadConfigFromFlags(flag.CommandLine)
-	flag.Parse()
-}
+	logger := cfg.Log.Logger()
+	logging.SetDefault(logger)
+	logging.RedirectStdLog(logger)
+	tokens.SetSecretKey(cfg.Security.JWTSecretKey)
+	secrets.SetEncryptionKey(cfg.Security.SecretsEncryptionKey)
 
-func Run() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	dbConn := db.New(ctx, db.NewConfig())
-	err := dbConn.Ping(ctx)
+	dbConn, err := db.New(ctx, db.NewConfig(cfg.MongoDB.ConnectionOptions()))
+	if err != nil {
+		log.Panicln(err)
+	}
+	err = dbConn.Ping(ctx)
 	if err != nil {
 		log.Panicln(err)
 	}
-	defer dbConn.Close(ctx)
 	log.Println("mongodb connected!")
 
-	rmqClient := rmq.NewClient(rmq.NewConfig())
-	defer rmqClient.Close()
-	log.Println("rabbitmq connected!")
+	var messageBus bus.Bus
+	if cfg.Bus.Transport == config.TransportMemory {
+		messageBus = memory.New(subscriptions.MemoryOptions())
+	} else {
+		rmqClient, err := rmq.NewClient(rmq.NewConfig(cfg.RabbitMQ.ConnectionOptions()), rmq.DefaultClientOptions())
+		if err != nil {
+			log.Panicln(err)
+		}
+		log.Println("rabbitmq connected!")
+		messageBus = amqpbus.New(rmqClient, subscriptions.AMQPOptions())
+	}
+
+	// messages published before the worker bound its queue would not be
+	// routed, so the api binds it as well
+	err = subscriptions.Bind(messageBus)
+	if err != nil {
+		log.Panicln(err)
+	}
 
-	temporalClient, err := client.NewClient(client.Options{})
+	temporalConfig := temporalclient.NewConfig(cfg.Temporal.ConnectionOptions())
+	temporalClient, err := temporalclient.New(ctx, temporalConfig)
+	if err != nil {
+		log.Panicln(err)
+	}
+	codec, err := temporalConfig.Codec()
 	if err != nil {
 		log.Panicln(err)
 	}
-	defer temporalClient.Close()
 
-	app := fiber.New()
-	app.Use(logger.New())
+	app := fiber.New(cfg.API.Fiber())
+	app.Use(handlers.RequestLogger())
 	app.Use(cors.New())
 
 	app.Get("/", func(c *fiber.Ctx) error {
@@ -63,15 +94,70 @@ func Run() {
 	})
 
 	usersStore := store.NewUsersStore(dbConn.DB())
-	usersService := users.NewService(usersStore)
+	transactionsStore := store.NewTransactionsStore(dbConn.DB())
+	loginAttemptsStore := store.NewLoginAttemptsStore(dbConn.DB())
+	guard := lockout.NewGuard(loginAttemptsStore, lockout.DefaultAccountPolicy, lockout.DefaultIPPolicy)
+	usersService := users.NewService(usersStore, transactionsStore, passwords.NewPolicy(cfg.Security.PasswordMinLength, cfg.Security.PasswordMaxLength), guard)
+
+	outboxStore := store.NewOutboxStore(dbConn.DB())
+	messageOutbox := outbox.New(outboxStore, dbConn)
+	relay := outbox.NewRelay(outboxStore, messageBus, outbox.DefaultRelayOptions())
 
 	subscriptionsStore := store.NewSubscriptionsStore(dbConn.DB())
-	subscriptionsService := subscriptions.NewService(usersStore, subscriptionsStore, temporalClient)
+	subscriptionsService := subscriptions.NewService(usersStore, subscriptionsStore, transactionsStore, store.NewSubscriptionEventsStore(dbConn.DB()), dbConn, messageOutbox, temporalClient)
+
+	commandsService := commands.NewService(store.NewCommandsStore(dbConn.DB()))
+
+	auditStore := store.NewAuditStore(dbConn.DB())
+	adminService := admin.NewService(usersStore, subscriptionsStore, transactionsStore, auditStore, dbConn, guard, messageBus)
+
+	accountsService := accounts.NewService(usersStore, subscriptionsStore, transactionsStore, store.NewAccountSummariesStore(dbConn.DB()), dbConn, subscriptionsService, temporalClient, cfg.API.BalancePolicy)
 
 	handlers.NewUsersHandlers(usersService, app)
-	handlers.NewSubscriptionsHandler(rmqClient.AsPublisher(), subscriptionsService, app)
+	handlers.NewAdminHandlers(usersService, adminService, codec, app)
+	handlers.NewAccountsHandlers(usersService, accountsService, app)
+	handlers.NewSubscriptionsHandler(messageOutbox, messageBus, usersService, subscriptionsService, commandsService, app)
+	handlers.NewCommandsHandlers(usersService, commandsService, app)
+
+	// without rabbitmq the worker can't reach the bus of the api, the api
+	// consumes the subscription commands itself
+	consume := cfg.Bus.Transport == config.TransportMemory
+	if consume {
+		subscriptions.NewHandler(subscriptionsService, commandsService, messageBus, messageBus, store.NewInboxStore(dbConn.DB()))
+	}
+
+	lc := lifecycle.NewManager(cfg.ShutdownTimeout)
+	lc.Go("http", func() error {
+		return app.Listen(cfg.API.Addr())
+	})
+	if consume {
+		lc.Go("consumer", func() error {
+			return subscriptions.Listen(messageBus)
+		})
+	}
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	lc.Go("outbox relay", func() error {
+		return relay.Run(relayCtx)
+	})
+	lc.OnStop("http", lifecycle.Func(app.Shutdown))
+	lc.OnStop("outbox relay", func(ctx context.Context) error {
+		stopRelay()
+		return nil
+	})
+	if consume {
+		lc.OnStop("consumer", messageBus.Stop)
+	}
+	lc.OnStop("temporal", lifecycle.Func(func() error {
+		temporalClient.Close()
+		return nil
+	}))
+	lc.OnStop("bus", lifecycle.Func(messageBus.Close))
+	lc.OnStop("mongodb", func(ctx context.Context) error {
+		dbConn.Close(ctx)
+		return nil
+	})
 
-	err = app.Listen(":8080")
+	err = lc.Wait()
 	if err != nil {
 		log.Panicln(err)
 	}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"go-temporal-workflow/services/accounts"
+	"go-temporal-workflow/services/users"
+	"net/http"
+)
+
+type accountsHandlers struct {
+	usersService    users.Service
+	accountsService accounts.Service
+}
+
+func NewAccountsHandlers(usersService users.Service, accountsService accounts.Service, app *fiber.App) {
+	h := &accountsHandlers{usersService: usersService, accountsService: accountsService}
+
+	app.Delete("/account", h.DeleteAccount)
+	app.Get("/account/export", h.GetExport)
+	app.Get("/account/summary", h.GetSummary)
+}
+
+func (h *accountsHandlers) DeleteAccount(ctx *fiber.Ctx) error {
+	payload, err := authenticate(ctx, h.usersService)
+	if err != nil {
+		return ctx.
+			Status(http.StatusBadRequest).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	out, err := h.accountsService.DeleteAccount(ctx.Context(), payload.UserID)
+	if err != nil {
+		return ctx.
+			Status(http.StatusUnprocessableEntity).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.
+		Status(http.StatusAccepted).
+		JSON(out)
+}
+
+func (h *accountsHandlers) GetExport(ctx *fiber.Ctx) error {
+	payload, err := authenticate(ctx, h.usersService)
+	if err != nil {
+		return ctx.
+			Status(http.StatusBadRequest).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	out, err := h.accountsService.Export(ctx.Context(), payload.UserID)
+	if err != nil {
+		return ctx.
+			Status(http.StatusUnprocessableEntity).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	filename := fmt.Sprintf("account-%s-%s.json", payload.UserID, out.ExportedAt.Format("20060102150405"))
+	ctx.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	return ctx.
+		Status(http.StatusOK).
+		JSON(out)
+}
+
+func (h *accountsHandlers) GetSummary(ctx *fiber.Ctx) error {
+	payload, err := authenticate(ctx, h.usersService)
+	if err != nil {
+		return ctx.
+			Status(http.StatusBadRequest).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	out, err := h.accountsService.Summary(ctx.Context(), payload.UserID)
+	if errors.Is(err, accounts.ErrSummaryNotReady) {
+		return ctx.
+			Status(http.StatusNotFound).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return ctx.
+			Status(http.StatusInternalServerError).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.
+		Status(http.StatusOK).
+		JSON(out)
+}
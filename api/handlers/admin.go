@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"go-temporal-workflow/bus"
+	"go-temporal-workflow/forms"
+	"go-temporal-workflow/models"
+	"go-temporal-workflow/services/admin"
+	"go-temporal-workflow/services/users"
+	"go-temporal-workflow/temporalclient"
+	"net/http"
+)
+
+type adminHandlers struct {
+	usersService users.Service
+	adminService admin.Service
+	codec        temporalclient.PayloadCodec
+}
+
+func NewAdminHandlers(usersService users.Service, adminService admin.Service, codec temporalclient.PayloadCodec, app *fiber.App) {
+	h := &adminHandlers{usersService: usersService, adminService: adminService, codec: codec}
+
+	g := app.Group("/admin", h.requireAdmin)
+	g.Get("/users", h.GetUsers)
+	g.Get("/users/:id", h.GetUser)
+	g.Get("/users/:id/audit", h.GetUserAudit)
+	g.Put("/users/:id/role", h.PutRole)
+	g.Post("/users/:id/suspend", h.PostSuspend)
+	g.Post("/users/:id/reactivate", h.PostReactivate)
+	g.Post("/users/:id/balance", h.PostAdjustBalance)
+	g.Post("/users/:id/unlock", h.PostUnlockUser)
+	g.Delete("/users/:id", h.DeleteUser)
+	g.Get("/dead-letters/:queue", h.GetDeadLetters)
+	g.Post("/dead-letters/:queue/replay", h.PostReplayDeadLetters)
+	g.Post("/codec/encode", h.PostCodecEncode)
+	g.Post("/codec/decode", h.PostCodecDecode)
+}
+
+func (h *adminHandlers) requireAdmin(ctx *fiber.Ctx) error {
+	payload, err := authenticate(ctx, h.usersService)
+	if err != nil {
+		return ctx.
+			Status(http.StatusBadRequest).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	user, err := h.usersService.GetUser(ctx.Context(), payload.UserID)
+	if err != nil || user.Role != models.RoleAdmin || user.Suspended {
+		return ctx.
+			Status(http.StatusForbidden).
+			JSON(fiber.Map{"error": "forbidden"})
+	}
+	ctx.Locals("user_id", payload.UserID)
+	return ctx.Next()
+}
+
+func (h *adminHandlers) GetUsers(ctx *fiber.Ctx) error {
+	var form forms.AdminUsersInput
+	err := ctx.QueryParser(&form)
+	if err != nil {
+		return ctx.
+			Status(http.StatusBadRequest).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	out, err := h.adminService.ListUsers(ctx.Context(), &form)
+	if err != nil {
+		return ctx.
+			Status(http.StatusInternalServerError).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.
+		Status(http.StatusOK).
+		JSON(out)
+}
+
+func (h *adminHandlers) GetUser(ctx *fiber.Ctx) error {
+	out, err := h.adminService.GetUser(ctx.Context(), ctx.Params("id"))
+	if err != nil {
+		return ctx.
+			Status(http.StatusNotFound).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.
+		Status(http.StatusOK).
+		JSON(out)
+}
+
+func (h *adminHandlers) GetUserAudit(ctx *fiber.Ctx) error {
+	out, err := h.adminService.GetAudit(ctx.Context(), ctx.Params("id"))
+	if err != nil {
+		return ctx.
+			Status(http.StatusBadRequest).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.
+		Status(http.StatusOK).
+		JSON(out)
+}
+
+func (h *adminHandlers) PutRole(ctx *fiber.Ctx) error {
+	var form forms.ChangeRoleInput
+	err := ctx.BodyParser(&form)
+	if err != nil {
+		return ctx.
+			Status(http.StatusBadRequest).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	h.setAction(ctx, &form.AdminActionInput)
+	out, err := h.adminService.ChangeRole(ctx.Context(), &form)
+	if err != nil {
+		return ctx.
+			Status(http.StatusUnprocessableEntity).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.
+		Status(http.StatusOK).
+		JSON(out)
+}
+
+func (h *adminHandlers) PostSuspend(ctx *fiber.Ctx) error {
+	form, err := h.parseAction(ctx)
+	if err != nil {
+		return ctx.
+			Status(http.StatusBadRequest).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	out, err := h.adminService.Suspend(ctx.Context(), form)
+	if err != nil {
+		return ctx.
+			Status(http.StatusUnprocessableEntity).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.
+		Status(http.StatusOK).
+		JSON(out)
+}
+
+func (h *adminHandlers) PostReactivate(ctx *fiber.Ctx) error {
+	form, err := h.parseAction(ctx)
+	if err != nil {
+		return ctx.
+			Status(http.StatusBadRequest).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	out, err := h.adminService.Reactivate(ctx.Context(), form)
+	if err != nil {
+		return ctx.
+			Status(http.StatusUnprocessableEntity).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.
+		Status(http.StatusOK).
+		JSON(out)
+}
+
+func (h *adminHandlers) PostAdjustBalance(ctx *fiber.Ctx) error {
+	var form forms.AdjustBalanceInput
+	err := ctx.BodyParser(&form)
+	if err != nil {
+		return ctx.
+			Status(http.StatusBadRequest).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	h.setAction(ctx, &form.AdminActionInput)
+	out, err := h.adminService.AdjustBalance(ctx.Context(), &form)
+	if err != nil {
+		return ctx.
+			Status(http.StatusUnprocessableEntity).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.
+		Status(http.StatusOK).
+		JSON(out)
+}
+
+func (h *adminHandlers) PostUnlockUser(ctx *fiber.Ctx) error {
+	form, err := h.parseAction(ctx)
+	if err != nil {
+		return ctx.
+			Status(http.StatusBadRequest).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	err = h.adminService.Unlock(ctx.Context(), form)
+	if err != nil {
+		return ctx.
+			Status(http.StatusUnprocessableEntity).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.
+		Status(http.StatusOK).
+		JSON(fiber.Map{"status": "unlocked"})
+}
+
+func (h *adminHandlers) DeleteUser(ctx *fiber.Ctx) error {
+	form, err := h.parseAction(ctx)
+	if err != nil {
+		return ctx.
+			Status(http.StatusBadRequest).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	err = h.adminService.DeleteUser(ctx.Context(), form)
+	if err != nil {
+		return ctx.
+			Status(http.StatusUnprocessableEntity).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.
+		Status(http.StatusOK).
+		JSON(fiber.Map{"status": "deleted"})
+}
+
+func (h *adminHandlers) GetDeadLetters(ctx *fiber.Ctx) error {
+	var form forms.DeadLettersInput
+	err := ctx.QueryParser(&form)
+	if err != nil {
+		return ctx.
+			Status(http.StatusBadRequest).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	form.Queue = ctx.Params("queue")
+	out, err := h.adminService.PeekDeadLetters(ctx.Context(), &form)
+	if err != nil {
+		return deadLettersError(ctx, err)
+	}
+	return ctx.
+		Status(http.StatusOK).
+		JSON(out)
+}
+
+func (h *adminHandlers) PostReplayDeadLetters(ctx *fiber.Ctx) error {
+	var form forms.DeadLettersInput
+	err := ctx.BodyParser(&form)
+	if err != nil {
+		return ctx.
+			Status(http.StatusBadRequest).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	form.ActorID, _ = ctx.Locals("user_id").(string)
+	form.Queue = ctx.Params("queue")
+	out, err := h.adminService.ReplayDeadLetters(ctx.Context(), &form)
+	if err != nil {
+		return deadLettersError(ctx, err)
+	}
+	return ctx.
+		Status(http.StatusOK).
+		JSON(out)
+}
+
+func deadLettersError(ctx *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, admin.ErrUnknownQueue):
+		return ctx.
+			Status(http.StatusNotFound).
+			JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, admin.ErrReasonRequired):
+		return ctx.
+			Status(http.StatusUnprocessableEntity).
+			JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, bus.ErrUnavailable), errors.Is(err, bus.ErrClosed):
+		return ctx.
+			Status(http.StatusServiceUnavailable).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.
+		Status(http.StatusInternalServerError).
+		JSON(fiber.Map{"error": err.Error()})
+}
+
+// parseAction reads the optional reason from the body. Requests without a
+// body are accepted.
+func (h *adminHandlers) parseAction(ctx *fiber.Ctx) (*forms.AdminActionInput, error) {
+	form := new(forms.AdminActionInput)
+	if len(ctx.Body()) > 0 {
+		err := ctx.BodyParser(form)
+		if err != nil {
+			return nil, err
+		}
+	}
+	h.setAction(ctx, form)
+	return form, nil
+}
+
+func (h *adminHandlers) setAction(ctx *fiber.Ctx, form *forms.AdminActionInput) {
+	form.ActorID, _ = ctx.Locals("user_id").(string)
+	form.UserID = ctx.Params("id")
+}
@@ -0,0 +1,12 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"go-temporal-workflow/security/tokens"
+	"go-temporal-workflow/services/users"
+)
+
+func authenticate(ctx *fiber.Ctx, usersService users.Service) (*tokens.TokenPayload, error) {
+	token := ctx.Request().Header.Peek("Authorization")
+	return usersService.Authenticate(ctx.Context(), string(token))
+}
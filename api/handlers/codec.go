@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"go-temporal-workflow/forms"
+	commonpb "go.temporal.io/api/common/v1"
+	"net/http"
+)
+
+// PostCodecEncode and PostCodecDecode implement the codec server protocol,
+// so Temporal Web and tctl can show the encrypted payloads of the histories.
+func (h *adminHandlers) PostCodecEncode(ctx *fiber.Ctx) error {
+	return h.runCodec(ctx, h.codec.Encode)
+}
+
+func (h *adminHandlers) PostCodecDecode(ctx *fiber.Ctx) error {
+	return h.runCodec(ctx, h.codec.Decode)
+}
+
+func (h *adminHandlers) runCodec(ctx *fiber.Ctx, fn func([]*commonpb.Payload) ([]*commonpb.Payload, error)) error {
+	var form forms.CodecPayloads
+	err := ctx.BodyParser(&form)
+	if err != nil {
+		return ctx.
+			Status(http.StatusBadRequest).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	payloads, err := fn(form.Payloads)
+	if err != nil {
+		return ctx.
+			Status(http.StatusUnprocessableEntity).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.
+		Status(http.StatusOK).
+		JSON(forms.CodecPayloads{Payloads: payloads})
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"go-temporal-workflow/services/commands"
+	"go-temporal-workflow/services/users"
+	"net/http"
+)
+
+type commandsHandlers struct {
+	usersService    users.Service
+	commandsService commands.Service
+}
+
+func NewCommandsHandlers(usersService users.Service, commandsService commands.Service, app *fiber.App) {
+	h := &commandsHandlers{usersService: usersService, commandsService: commandsService}
+
+	app.Get("/commands/:id", h.GetCommand)
+}
+
+func (h *commandsHandlers) GetCommand(ctx *fiber.Ctx) error {
+	payload, err := authenticate(ctx, h.usersService)
+	if err != nil {
+		return ctx.
+			Status(http.StatusBadRequest).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	out, err := h.commandsService.Get(ctx.Context(), payload.UserID, ctx.Params("id"))
+	if errors.Is(err, commands.ErrCommandNotFound) {
+		return ctx.
+			Status(http.StatusNotFound).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return ctx.
+			Status(http.StatusInternalServerError).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.
+		Status(http.StatusOK).
+		JSON(out)
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"go-temporal-workflow/logging"
+	"time"
+)
+
+const (
+	HeaderRequestID = "X-Request-ID"
+
+	// requestIDMaxLength bounds the request IDs taken from clients, they end
+	// up in every log entry of the request.
+	requestIDMaxLength = 128
+)
+
+// RequestLogger gives every request an ID, taken from the X-Request-ID
+// header or generated, and logs the request once it is handled. Services
+// called with ctx.Context() find the ID with logging.RequestID.
+func RequestLogger() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		start := time.Now()
+		id := ctx.Get(HeaderRequestID)
+		if id == "" || len(id) > requestIDMaxLength {
+			id = logging.NewRequestID()
+		}
+		ctx.Locals(logging.RequestIDKey, id)
+		ctx.Set(HeaderRequestID, id)
+
+		err := ctx.Next()
+		if err != nil {
+			// write the error response now so the status is logged
+			handlerErr := ctx.App().ErrorHandler(ctx, err)
+			if handlerErr != nil {
+				_ = ctx.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		status := ctx.Response().StatusCode()
+		logger := logging.FromContext(ctx.Context())
+		keyvals := []interface{}{
+			"method", ctx.Method(),
+			"path", ctx.Path(),
+			"status", status,
+			"latency", time.Since(start),
+			"ip", ctx.IP(),
+		}
+		if err != nil {
+			keyvals = append(keyvals, "err", err)
+		}
+		if status >= fiber.StatusInternalServerError {
+			logger.Error("request", keyvals...)
+		} else {
+			logger.Info("request", keyvals...)
+		}
+		return nil
+	}
+}
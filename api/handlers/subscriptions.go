@@ -1,33 +1,47 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"github.com/gofiber/fiber/v2"
+	"go-temporal-workflow/bus"
 	"go-temporal-workflow/forms"
-	"go-temporal-workflow/rmq"
-	"go-temporal-workflow/security/tokens"
+	"go-temporal-workflow/logging"
+	"go-temporal-workflow/outbox"
+	"go-temporal-workflow/services/commands"
 	"go-temporal-workflow/services/subscriptions"
+	"go-temporal-workflow/services/users"
 	"net/http"
+	"time"
 )
 
 type SubscriptionsHandlers interface {
 }
 
+// subscribeTimeout is how long POST /subscriptions?wait=true waits for the
+// workflow to start.
+const subscribeTimeout = 10 * time.Second
+
 type subscriptionsHandlers struct {
-	publisher            rmq.Publisher
+	outbox               outbox.Outbox
+	requester            bus.Requester
+	usersService         users.Service
 	subscriptionsService subscriptions.Service
+	commandsService      commands.Service
 }
 
-func NewSubscriptionsHandler(publisher rmq.Publisher, subscriptionsService subscriptions.Service, app *fiber.App) {
-	h := subscriptionsHandlers{publisher: publisher, subscriptionsService: subscriptionsService}
+func NewSubscriptionsHandler(outbox outbox.Outbox, requester bus.Requester, usersService users.Service, subscriptionsService subscriptions.Service, commandsService commands.Service, app *fiber.App) {
+	h := subscriptionsHandlers{outbox: outbox, requester: requester, usersService: usersService, subscriptionsService: subscriptionsService, commandsService: commandsService}
 
 	app.Post("/subscriptions", h.PostSubscribe)
 	app.Get("/subscriptions/workflows/:id", h.GetWorkflow)
+	app.Get("/subscriptions/:id/history", h.GetHistory)
 	app.Put("/subscriptions/workflows/:id/cancel", h.PutCancelWorkflow)
 }
 
 func (h *subscriptionsHandlers) PostSubscribe(ctx *fiber.Ctx) error {
-	token := ctx.Request().Header.Peek("Authorization")
-	payload, err := tokens.Parse(string(token))
+	payload, err := authenticate(ctx, h.usersService)
 	if err != nil {
 		return ctx.
 			Status(http.StatusBadRequest).
@@ -38,25 +52,59 @@ func (h *subscriptionsHandlers) PostSubscribe(ctx *fiber.Ctx) error {
 		UserID: payload.UserID,
 	}
 
-	err = h.publisher.Send(&rmq.PublisherOptions{
-		ExchangeName: "subscription",
-		Persistent:   true,
-		Message:      rmq.NewMessage(msg),
-	})
+	message, err := bus.NewMessage(msg)
 	if err != nil {
 		return ctx.
 			Status(http.StatusInternalServerError).
 			JSON(fiber.Map{"error": err.Error()})
 	}
+	message.RequestID = logging.RequestID(ctx.Context())
+
+	if ctx.Query("wait") == "true" {
+		return h.subscribeAndWait(ctx, payload.UserID, message)
+	}
+
+	err = h.send(ctx, payload.UserID, message)
+	if err != nil {
+		return publishError(ctx, err)
+	}
+	return accepted(ctx, message.ID)
+}
 
+// subscribeAndWait sends the subscribe message through the outbox like send
+// and waits for the consumer to reply with the outcome. When the reply takes
+// too long, or goes to another api process because its relay published the
+// request, the client gets the command id to poll instead.
+func (h *subscriptionsHandlers) subscribeAndWait(ctx *fiber.Ctx, userID string, message *bus.Message) error {
+	reply, err := h.requester.Request(message, func(msg *bus.Message) error {
+		return h.send(ctx, userID, msg)
+	}, subscribeTimeout)
+	if errors.Is(err, bus.ErrRequestTimeout) {
+		return accepted(ctx, message.ID)
+	}
+	if err != nil {
+		return publishError(ctx, err)
+	}
+
+	var out forms.SubscribeReply
+	err = json.Unmarshal(reply.Data, &out)
+	if err != nil {
+		return ctx.
+			Status(http.StatusInternalServerError).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	if out.Error != "" {
+		return ctx.
+			Status(http.StatusUnprocessableEntity).
+			JSON(fiber.Map{"error": out.Error})
+	}
 	return ctx.
-		Status(http.StatusOK).
-		JSON(fiber.Map{"status": "sent"})
+		Status(http.StatusCreated).
+		JSON(out)
 }
 
 func (h *subscriptionsHandlers) GetWorkflow(ctx *fiber.Ctx) error {
-	token := ctx.Request().Header.Peek("Authorization")
-	_, err := tokens.Parse(string(token))
+	_, err := authenticate(ctx, h.usersService)
 	if err != nil {
 		return ctx.
 			Status(http.StatusBadRequest).
@@ -74,9 +122,32 @@ func (h *subscriptionsHandlers) GetWorkflow(ctx *fiber.Ctx) error {
 		JSON(out)
 }
 
+func (h *subscriptionsHandlers) GetHistory(ctx *fiber.Ctx) error {
+	payload, err := authenticate(ctx, h.usersService)
+	if err != nil {
+		return ctx.
+			Status(http.StatusBadRequest).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+
+	out, err := h.subscriptionsService.History(ctx.Context(), payload.UserID, ctx.Params("id"))
+	if errors.Is(err, subscriptions.ErrNotFound) {
+		return ctx.
+			Status(http.StatusNotFound).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return ctx.
+			Status(http.StatusBadRequest).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.
+		Status(http.StatusOK).
+		JSON(out)
+}
+
 func (h *subscriptionsHandlers) PutCancelWorkflow(ctx *fiber.Ctx) error {
-	token := ctx.Request().Header.Peek("Authorization")
-	payload, err := tokens.Parse(string(token))
+	payload, err := authenticate(ctx, h.usersService)
 	if err != nil {
 		return ctx.
 			Status(http.StatusBadRequest).
@@ -88,17 +159,46 @@ func (h *subscriptionsHandlers) PutCancelWorkflow(ctx *fiber.Ctx) error {
 		SubID:  ctx.Params("id"),
 	}
 
-	err = h.publisher.Send(&rmq.PublisherOptions{
-		ExchangeName: "subscription",
-		Persistent:   true,
-		Message:      rmq.NewMessage(msg),
-	})
+	message, err := bus.NewMessage(msg)
 	if err != nil {
 		return ctx.
 			Status(http.StatusInternalServerError).
 			JSON(fiber.Map{"error": err.Error()})
 	}
+	message.RequestID = logging.RequestID(ctx.Context())
+
+	err = h.send(ctx, payload.UserID, message)
+	if err != nil {
+		return publishError(ctx, err)
+	}
+	return accepted(ctx, message.ID)
+}
+
+// send stores the command record and the outgoing message together.
+func (h *subscriptionsHandlers) send(ctx *fiber.Ctx, userID string, message *bus.Message) error {
+	return h.outbox.Transaction(ctx.Context(), func(txCtx context.Context) error {
+		err := h.commandsService.Create(txCtx, message.ID, message.Type, userID)
+		if err != nil {
+			return err
+		}
+		return h.outbox.Enqueue(txCtx, subscriptions.Exchange, "", message)
+	})
+}
+
+func accepted(ctx *fiber.Ctx, commandID string) error {
+	ctx.Location("/commands/" + commandID)
+	return ctx.
+		Status(http.StatusAccepted).
+		JSON(fiber.Map{"status": "pending", "command_id": commandID})
+}
+
+func publishError(ctx *fiber.Ctx, err error) error {
+	if errors.Is(err, bus.ErrUnavailable) || errors.Is(err, bus.ErrNotRouted) || errors.Is(err, bus.ErrClosed) {
+		return ctx.
+			Status(http.StatusServiceUnavailable).
+			JSON(fiber.Map{"error": err.Error()})
+	}
 	return ctx.
-		Status(http.StatusOK).
-		JSON(fiber.Map{"status": "sent"})
+		Status(http.StatusInternalServerError).
+		JSON(fiber.Map{"error": err.Error()})
 }
@@ -1,11 +1,16 @@
 package handlers
 
 import (
+	"errors"
 	"github.com/gofiber/fiber/v2"
 	"go-temporal-workflow/forms"
-	"go-temporal-workflow/security/tokens"
+	"go-temporal-workflow/logging"
+	"go-temporal-workflow/security/lockout"
 	"go-temporal-workflow/services/users"
+	"go-temporal-workflow/store"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
@@ -22,6 +27,10 @@ func NewUsersHandlers(usersService users.Service, app *fiber.App) {
 	handler := &usersHandlers{usersService: usersService}
 	app.Post("/signup", handler.PostSignUp)
 	app.Post("/signin", handler.PostSignIn)
+	app.Post("/signin/mfa", handler.PostSignInMFA)
+	app.Post("/mfa/enroll", handler.PostEnrollMFA)
+	app.Post("/mfa/activate", handler.PostActivateMFA)
+	app.Post("/mfa/disable", handler.PostDisableMFA)
 	app.Get("/access", handler.GetAccess)
 	app.Post("/deposit", handler.PostDeposit)
 }
@@ -55,7 +64,68 @@ func (h *usersHandlers) PostSignIn(ctx *fiber.Ctx) error {
 			JSON(fiber.Map{"error": err.Error()})
 	}
 	form.Email = strings.ToLower(strings.TrimSpace(form.Email))
+	form.IP = ctx.IP()
 	out, err := h.usersService.SignIn(ctx.Context(), form)
+	if err != nil {
+		return signInError(ctx, err)
+	}
+	return ctx.
+		Status(http.StatusOK).
+		JSON(out)
+}
+
+func (h *usersHandlers) PostSignInMFA(ctx *fiber.Ctx) error {
+	form := new(forms.MFAChallengeInput)
+	err := ctx.BodyParser(form)
+	if err != nil {
+		return ctx.
+			Status(http.StatusBadRequest).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	form.IP = ctx.IP()
+	out, err := h.usersService.VerifyMFA(ctx.Context(), form)
+	if err != nil {
+		return signInError(ctx, err)
+	}
+	return ctx.
+		Status(http.StatusOK).
+		JSON(out)
+}
+
+func (h *usersHandlers) PostEnrollMFA(ctx *fiber.Ctx) error {
+	payload, err := authenticate(ctx, h.usersService)
+	if err != nil {
+		return ctx.
+			Status(http.StatusBadRequest).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	out, err := h.usersService.EnrollMFA(ctx.Context(), payload.UserID)
+	if err != nil {
+		return ctx.
+			Status(http.StatusUnprocessableEntity).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.
+		Status(http.StatusOK).
+		JSON(out)
+}
+
+func (h *usersHandlers) PostActivateMFA(ctx *fiber.Ctx) error {
+	payload, err := authenticate(ctx, h.usersService)
+	if err != nil {
+		return ctx.
+			Status(http.StatusBadRequest).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	form := new(forms.MFACodeInput)
+	err = ctx.BodyParser(form)
+	if err != nil {
+		return ctx.
+			Status(http.StatusBadRequest).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	form.UserID = payload.UserID
+	out, err := h.usersService.ActivateMFA(ctx.Context(), form)
 	if err != nil {
 		return ctx.
 			Status(http.StatusUnprocessableEntity).
@@ -66,9 +136,34 @@ func (h *usersHandlers) PostSignIn(ctx *fiber.Ctx) error {
 		JSON(out)
 }
 
+func (h *usersHandlers) PostDisableMFA(ctx *fiber.Ctx) error {
+	payload, err := authenticate(ctx, h.usersService)
+	if err != nil {
+		return ctx.
+			Status(http.StatusBadRequest).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	form := new(forms.MFACodeInput)
+	err = ctx.BodyParser(form)
+	if err != nil {
+		return ctx.
+			Status(http.StatusBadRequest).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	form.UserID = payload.UserID
+	err = h.usersService.DisableMFA(ctx.Context(), form)
+	if err != nil {
+		return ctx.
+			Status(http.StatusUnprocessableEntity).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	return ctx.
+		Status(http.StatusOK).
+		JSON(fiber.Map{"status": "disabled"})
+}
+
 func (h *usersHandlers) GetAccess(ctx *fiber.Ctx) error {
-	token := ctx.Request().Header.Peek("Authorization")
-	payload, err := tokens.Parse(string(token))
+	payload, err := authenticate(ctx, h.usersService)
 	if err != nil {
 		return ctx.
 			Status(http.StatusBadRequest).
@@ -86,8 +181,7 @@ func (h *usersHandlers) GetAccess(ctx *fiber.Ctx) error {
 }
 
 func (h *usersHandlers) PostDeposit(ctx *fiber.Ctx) error {
-	token := ctx.Request().Header.Peek("Authorization")
-	_, err := tokens.Parse(string(token))
+	_, err := authenticate(ctx, h.usersService)
 	if err != nil {
 		return ctx.
 			Status(http.StatusBadRequest).
@@ -101,6 +195,11 @@ func (h *usersHandlers) PostDeposit(ctx *fiber.Ctx) error {
 			JSON(fiber.Map{"error": err.Error()})
 	}
 	user, err := h.usersService.Deposit(ctx.Context(), &form)
+	if errors.Is(err, store.ErrConflict) {
+		return ctx.
+			Status(http.StatusConflict).
+			JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return ctx.
 			Status(http.StatusUnauthorized).
@@ -110,3 +209,29 @@ func (h *usersHandlers) PostDeposit(ctx *fiber.Ctx) error {
 		Status(http.StatusOK).
 		JSON(user)
 }
+
+// signInError keeps sign in failures uniform, so responses don't reveal
+// whether an email is registered.
+func signInError(ctx *fiber.Ctx, err error) error {
+	var locked *lockout.LockedError
+	if errors.As(err, &locked) {
+		ctx.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+		return ctx.
+			Status(http.StatusTooManyRequests).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors.Is(err, users.ErrAccountSuspended) {
+		return ctx.
+			Status(http.StatusForbidden).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors.Is(err, users.ErrInvalidCredentials) || errors.Is(err, users.ErrInvalidMFACode) {
+		return ctx.
+			Status(http.StatusUnauthorized).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+	logging.FromContext(ctx.Context()).Error("error on sign in", "err", err)
+	return ctx.
+		Status(http.StatusUnauthorized).
+		JSON(fiber.Map{"error": users.ErrInvalidCredentials.Error()})
+}
@@ -0,0 +1,143 @@
+// Package amqpbus implements the bus on RabbitMQ through rmq. Topics are
+// direct exchanges and queues are bound to them by routing key.
+package amqpbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/streadway/amqp"
+	"go-temporal-workflow/bus"
+	"go-temporal-workflow/rmq"
+	"time"
+)
+
+// Options controls how topics and queues are declared and consumed.
+// Durable topics and queues survive a broker restart and their messages are
+// published persistent. Retry adds retry queues and a dead-letter queue to
+// every bound queue.
+type Options struct {
+	Durable    bool
+	AutoDelete bool
+	Prefetch   int
+	Retry      *rmq.RetryOptions
+}
+
+func DefaultOptions() *Options {
+	return &Options{
+		Durable:  true,
+		Prefetch: 32,
+	}
+}
+
+type amqpBus struct {
+	client   rmq.Client
+	consumer rmq.Consumer
+	opts     *Options
+}
+
+func New(client rmq.Client, opts *Options) bus.Bus {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	return &amqpBus{client: client, consumer: client.AsConsumer(), opts: opts}
+}
+
+func (b *amqpBus) Bind(topic, key, queue string) error {
+	err := b.client.ExchangeDeclare(&rmq.ExchangeOptions{
+		Name:       topic,
+		Kind:       amqp.ExchangeDirect,
+		Durable:    b.opts.Durable,
+		AutoDelete: b.opts.AutoDelete,
+	})
+	if err != nil {
+		return err
+	}
+	return b.client.QueueDeclare(&rmq.QueueOptions{
+		Name:       queue,
+		Durable:    b.opts.Durable,
+		AutoDelete: b.opts.AutoDelete,
+		BindOptions: &rmq.QueueBindOptions{
+			RoutingKey:   key,
+			ExchangeName: topic,
+		},
+		Retry: b.opts.Retry,
+	})
+}
+
+func (b *amqpBus) Publish(_ context.Context, topic, key string, msg *bus.Message) error {
+	return busError(b.client.AsPublisher().Send(&rmq.PublisherOptions{
+		ExchangeName: topic,
+		RoutingKey:   key,
+		Mandatory:    true,
+		Persistent:   b.opts.Durable,
+		Message:      msg,
+	}))
+}
+
+// Request relies on direct reply-to: the reply only comes back when send
+// publishes through the client of this bus.
+func (b *amqpBus) Request(msg *bus.Message, send func(msg *bus.Message) error, timeout time.Duration) (*bus.Message, error) {
+	reply, err := b.client.AsPublisher().Await(msg, send, timeout)
+	return reply, busError(err)
+}
+
+func (b *amqpBus) Reply(request *bus.Message, v interface{}) error {
+	return busError(b.client.AsPublisher().Reply(request, v))
+}
+
+// Peek and Replay find dead letters only on queues bound with Retry.
+func (b *amqpBus) Peek(queue string, limit int) ([]*bus.DeadLetter, error) {
+	letters, err := b.client.AsDeadLetters().Peek(queue, limit)
+	return letters, busError(err)
+}
+
+func (b *amqpBus) Replay(queue string, limit int) (int, error) {
+	replayed, err := b.client.AsDeadLetters().Replay(queue, limit)
+	return replayed, busError(err)
+}
+
+func (b *amqpBus) HandleFunc(name string, version int, handler func(msg *bus.Message) error) {
+	b.consumer.HandleFunc(name, version, handler)
+}
+
+func (b *amqpBus) Upcast(name string, from int, upcaster bus.Upcaster) {
+	b.consumer.Upcast(name, from, upcaster)
+}
+
+func (b *amqpBus) Listen(queue string, opts *bus.ListenOptions) error {
+	if opts == nil {
+		opts = &bus.ListenOptions{}
+	}
+	return b.consumer.Listen(&rmq.ConsumerOptions{
+		QueueName: queue,
+		Prefetch:  b.opts.Prefetch,
+		Workers:   opts.Workers,
+		KeyFunc:   opts.KeyFunc,
+	})
+}
+
+func (b *amqpBus) Stop(ctx context.Context) error {
+	return b.consumer.Stop(ctx)
+}
+
+func (b *amqpBus) Close() error {
+	b.client.Close()
+	return nil
+}
+
+// busError maps the errors of rmq to the errors of the bus, keeping the
+// original error in the message.
+func busError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, rmq.ErrReturned):
+		return fmt.Errorf("%w: %s", bus.ErrNotRouted, err)
+	case errors.Is(err, rmq.ErrClosed):
+		return bus.ErrClosed
+	case errors.Is(err, rmq.ErrNotDelivered), errors.Is(err, rmq.ErrBufferFull):
+		return fmt.Errorf("%w: %s", bus.ErrUnavailable, err)
+	}
+	return err
+}
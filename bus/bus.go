@@ -0,0 +1,58 @@
+// Package bus defines the messaging contracts used by the services, apart
+// from the transport. The amqp package implements them on RabbitMQ and the
+// memory package in process.
+//
+// Messages are published to a topic with a routing key and delivered to the
+// queues bound to that topic with the same key. A queue delivers each message
+// to one of its listeners. A message is acked when its handler succeeds and
+// redelivered when it fails, unless the error is permanent, and ends up in
+// the dead letters of the queue when it keeps failing.
+//
+// A request is a message whose handler answers with a reply. The requester
+// waits for the reply, which is matched to the request by its causation id.
+package bus
+
+import (
+	"context"
+	"time"
+)
+
+type Publisher interface {
+	Publish(ctx context.Context, topic, key string, msg *Message) error
+}
+
+type Consumer interface {
+	Handlers
+	// Listen handles the messages of queue until Stop is called.
+	Listen(queue string, opts *ListenOptions) error
+	// Stop stops delivering messages and waits for the handlers running.
+	Stop(ctx context.Context) error
+}
+
+type Requester interface {
+	// Request sets ReplyTo on a copy of msg, calls send to publish it and
+	// waits up to timeout for the reply. send may publish through the
+	// outbox, the reply then arrives once the relay published the request.
+	Request(msg *Message, send func(msg *Message) error, timeout time.Duration) (*Message, error)
+	// Reply publishes v as the reply to request. It does nothing when the
+	// request doesn't expect a reply.
+	Reply(request *Message, v interface{}) error
+}
+
+type Bus interface {
+	Publisher
+	Consumer
+	Requester
+	DeadLetters
+	Bind(topic, key, queue string) error
+	Close() error
+}
+
+// ListenOptions configures how a queue is consumed. Messages with the same
+// key, as returned by KeyFunc, are handled in order by one of Workers
+// goroutines. The AMQP transport retries failed messages through the
+// broker, so a retried message is handled after the later ones of its key.
+type ListenOptions struct {
+	Workers int
+	KeyFunc func(msg *Message) string
+}
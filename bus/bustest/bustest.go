@@ -0,0 +1,444 @@
+// Package bustest holds the conformance tests every bus implementation must
+// pass. Implementations call Run from their own tests.
+package bustest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-temporal-workflow/bus"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	pingMessage   = "bustest.ping"
+	upcastMessage = "bustest.upcast"
+
+	// waitTimeout bounds every wait for a delivery, quiet is how long a test
+	// waits to be sure a message is not delivered again.
+	waitTimeout = 5 * time.Second
+	quiet       = 500 * time.Millisecond
+)
+
+type ping struct {
+	N int `json:"n"`
+}
+
+// upcastV1 is the old shape of an upcast message, v2 renamed n to count.
+type upcastV1 struct {
+	N int `json:"n"`
+}
+
+func init() {
+	bus.RegisterType(pingMessage, 1, ping{})
+	bus.RegisterType(upcastMessage, 1, upcastV1{})
+}
+
+// Factory returns a new bus for each test. Tests use unique topic and queue
+// names, so buses may share a broker.
+type Factory func(t *testing.T) bus.Bus
+
+// Run runs every test except the skipped ones, which an implementation
+// names when it documents that it doesn't give that guarantee.
+func Run(t *testing.T, factory Factory, skip ...string) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, b bus.Bus)
+	}{
+		{"Routing", testRouting},
+		{"NotRouted", testNotRouted},
+		{"Envelope", testEnvelope},
+		{"AckOnSuccess", testAckOnSuccess},
+		{"RedeliverOnFailure", testRedeliverOnFailure},
+		{"KeyOrderAfterFailure", testKeyOrderAfterFailure},
+		{"PermanentFailure", testPermanentFailure},
+		{"Upcast", testUpcast},
+		{"StopDrains", testStopDrains},
+		{"RequestReply", testRequestReply},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range skip {
+				if name == tt.name {
+					t.Skip("not supported by this implementation")
+				}
+			}
+			b := factory(t)
+			defer func() {
+				_ = b.Close()
+			}()
+			tt.test(t, b)
+		})
+	}
+}
+
+// recorder collects the messages a handler received.
+type recorder struct {
+	mu       sync.Mutex
+	messages []*bus.Message
+	received chan struct{}
+}
+
+func newRecorder() *recorder {
+	return &recorder{received: make(chan struct{}, 100)}
+}
+
+func (r *recorder) record(msg *bus.Message) {
+	r.mu.Lock()
+	copied := *msg
+	r.messages = append(r.messages, &copied)
+	r.mu.Unlock()
+	r.received <- struct{}{}
+}
+
+func (r *recorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.messages)
+}
+
+func (r *recorder) get(i int) *bus.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.messages[i]
+}
+
+// wait blocks until n messages were received in total.
+func (r *recorder) wait(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.After(waitTimeout)
+	for r.count() < n {
+		select {
+		case <-r.received:
+		case <-deadline:
+			t.Fatalf("received %d messages, want %d", r.count(), n)
+		}
+	}
+}
+
+// stays checks that no more than n messages are received.
+func (r *recorder) stays(t *testing.T, n int) {
+	t.Helper()
+	time.Sleep(quiet)
+	if got := r.count(); got != n {
+		t.Fatalf("received %d messages, want %d", got, n)
+	}
+}
+
+func names() (topic, queue string) {
+	id := bus.NewID()[:8]
+	return "bustest." + id, "bustest." + id + ".queue"
+}
+
+func listen(t *testing.T, b bus.Bus, queue string) {
+	go func() {
+		err := b.Listen(queue, &bus.ListenOptions{Workers: 2})
+		if err != nil {
+			t.Errorf("listen: %s", err)
+		}
+	}()
+}
+
+func publish(t *testing.T, b bus.Bus, topic, key string, v interface{}) *bus.Message {
+	t.Helper()
+	msg, err := bus.NewMessage(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Publish(context.Background(), topic, key, msg)
+	if err != nil {
+		t.Fatalf("publish: %s", err)
+	}
+	return msg
+}
+
+func testRouting(t *testing.T, b bus.Bus) {
+	topic, queue := names()
+	other := queue + ".other"
+	mustBind(t, b, topic, "a", queue)
+	mustBind(t, b, topic, "a", other)
+	mustBind(t, b, topic, "b", queue)
+
+	r := newRecorder()
+	b.HandleFunc(pingMessage, 1, func(msg *bus.Message) error {
+		r.record(msg)
+		return nil
+	})
+	listen(t, b, queue)
+	listen(t, b, other)
+
+	// key a is bound to both queues, key b to one
+	publish(t, b, topic, "a", ping{N: 1})
+	publish(t, b, topic, "b", ping{N: 2})
+	r.wait(t, 3)
+	r.stays(t, 3)
+}
+
+func testNotRouted(t *testing.T, b bus.Bus) {
+	topic, queue := names()
+	mustBind(t, b, topic, "a", queue)
+
+	msg, err := bus.NewMessage(ping{N: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Publish(context.Background(), topic, "missing", msg)
+	if !errors.Is(err, bus.ErrNotRouted) {
+		t.Fatalf("publish to unbound key: got %v, want ErrNotRouted", err)
+	}
+}
+
+func testEnvelope(t *testing.T, b bus.Bus) {
+	topic, queue := names()
+	mustBind(t, b, topic, "", queue)
+
+	r := newRecorder()
+	b.HandleFunc(pingMessage, 1, func(msg *bus.Message) error {
+		r.record(msg)
+		return nil
+	})
+	listen(t, b, queue)
+
+	cause, err := bus.NewMessage(ping{N: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cause.RequestID = "request-1"
+	sent, err := bus.NewMessageFrom(cause, ping{N: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Publish(context.Background(), topic, "", sent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.wait(t, 1)
+
+	got := r.get(0)
+	if got.ID != sent.ID || got.Type != pingMessage || got.Version != 1 {
+		t.Errorf("got id=%s type=%s version=%d, want id=%s type=%s version=1", got.ID, got.Type, got.Version, sent.ID, pingMessage)
+	}
+	if got.CorrelationID != cause.CorrelationID || got.CausationID != cause.ID {
+		t.Errorf("got correlation=%s causation=%s, want correlation=%s causation=%s", got.CorrelationID, got.CausationID, cause.CorrelationID, cause.ID)
+	}
+	if got.RequestID != cause.RequestID {
+		t.Errorf("got request id %q, want %q", got.RequestID, cause.RequestID)
+	}
+	if !got.Timestamp.Equal(sent.Timestamp.Truncate(time.Second)) && !got.Timestamp.Equal(sent.Timestamp) {
+		t.Errorf("got timestamp %s, want %s", got.Timestamp, sent.Timestamp)
+	}
+	var p ping
+	err = json.Unmarshal(got.Data, &p)
+	if err != nil || p.N != 2 {
+		t.Errorf("got data %s, want n=2", got.Data)
+	}
+}
+
+func testAckOnSuccess(t *testing.T, b bus.Bus) {
+	topic, queue := names()
+	mustBind(t, b, topic, "", queue)
+
+	r := newRecorder()
+	b.HandleFunc(pingMessage, 1, func(msg *bus.Message) error {
+		r.record(msg)
+		return nil
+	})
+	listen(t, b, queue)
+
+	publish(t, b, topic, "", ping{N: 1})
+	r.wait(t, 1)
+	r.stays(t, 1)
+}
+
+func testRedeliverOnFailure(t *testing.T, b bus.Bus) {
+	topic, queue := names()
+	mustBind(t, b, topic, "", queue)
+
+	r := newRecorder()
+	b.HandleFunc(pingMessage, 1, func(msg *bus.Message) error {
+		r.record(msg)
+		if r.count() == 1 {
+			return errors.New("first attempt fails")
+		}
+		return nil
+	})
+	listen(t, b, queue)
+
+	sent := publish(t, b, topic, "", ping{N: 1})
+	r.wait(t, 2)
+	r.stays(t, 2)
+	if r.get(1).ID != sent.ID {
+		t.Errorf("redelivered id %s, want %s", r.get(1).ID, sent.ID)
+	}
+}
+
+func testKeyOrderAfterFailure(t *testing.T, b bus.Bus) {
+	topic, queue := names()
+	mustBind(t, b, topic, "", queue)
+
+	r := newRecorder()
+	var mu sync.Mutex
+	failed := false
+	b.HandleFunc(pingMessage, 1, func(msg *bus.Message) error {
+		var p ping
+		err := json.Unmarshal(msg.Data, &p)
+		if err != nil {
+			return bus.Permanent(err)
+		}
+		mu.Lock()
+		fail := p.N == 1 && !failed
+		failed = failed || fail
+		mu.Unlock()
+		if fail {
+			return errors.New("first attempt fails")
+		}
+		r.record(msg)
+		return nil
+	})
+	go func() {
+		err := b.Listen(queue, &bus.ListenOptions{
+			Workers: 2,
+			KeyFunc: func(msg *bus.Message) string { return "same" },
+		})
+		if err != nil {
+			t.Errorf("listen: %s", err)
+		}
+	}()
+
+	first := publish(t, b, topic, "", ping{N: 1})
+	second := publish(t, b, topic, "", ping{N: 2})
+	r.wait(t, 2)
+	if r.get(0).ID != first.ID || r.get(1).ID != second.ID {
+		t.Errorf("handled %s then %s, want %s then %s", r.get(0).ID, r.get(1).ID, first.ID, second.ID)
+	}
+}
+
+func testPermanentFailure(t *testing.T, b bus.Bus) {
+	topic, queue := names()
+	mustBind(t, b, topic, "", queue)
+
+	r := newRecorder()
+	b.HandleFunc(pingMessage, 1, func(msg *bus.Message) error {
+		r.record(msg)
+		return bus.Permanent(errors.New("never works"))
+	})
+	listen(t, b, queue)
+
+	publish(t, b, topic, "", ping{N: 1})
+	r.wait(t, 1)
+	r.stays(t, 1)
+}
+
+func testUpcast(t *testing.T, b bus.Bus) {
+	topic, queue := names()
+	mustBind(t, b, topic, "", queue)
+
+	r := newRecorder()
+	b.Upcast(upcastMessage, 1, func(data []byte) ([]byte, error) {
+		var v1 upcastV1
+		err := json.Unmarshal(data, &v1)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]int{"count": v1.N})
+	})
+	b.HandleFunc(upcastMessage, 2, func(msg *bus.Message) error {
+		r.record(msg)
+		return nil
+	})
+	listen(t, b, queue)
+
+	publish(t, b, topic, "", upcastV1{N: 7})
+	r.wait(t, 1)
+
+	got := r.get(0)
+	var v2 struct {
+		Count int `json:"count"`
+	}
+	err := json.Unmarshal(got.Data, &v2)
+	if err != nil || got.Version != 2 || v2.Count != 7 {
+		t.Errorf("got version=%d data=%s, want version=2 count=7", got.Version, got.Data)
+	}
+}
+
+func testStopDrains(t *testing.T, b bus.Bus) {
+	topic, queue := names()
+	mustBind(t, b, topic, "", queue)
+
+	started := make(chan struct{})
+	var finished bool
+	var mu sync.Mutex
+	b.HandleFunc(pingMessage, 1, func(msg *bus.Message) error {
+		close(started)
+		time.Sleep(quiet)
+		mu.Lock()
+		finished = true
+		mu.Unlock()
+		return nil
+	})
+	listen(t, b, queue)
+
+	publish(t, b, topic, "", ping{N: 1})
+	select {
+	case <-started:
+	case <-time.After(waitTimeout):
+		t.Fatal("message not delivered")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+	err := b.Stop(ctx)
+	if err != nil {
+		t.Fatalf("stop: %s", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !finished {
+		t.Error("stop returned before the running handler finished")
+	}
+}
+
+func testRequestReply(t *testing.T, b bus.Bus) {
+	topic, queue := names()
+	mustBind(t, b, topic, "", queue)
+
+	b.HandleFunc(pingMessage, 1, func(msg *bus.Message) error {
+		var p ping
+		err := json.Unmarshal(msg.Data, &p)
+		if err != nil {
+			return bus.Permanent(err)
+		}
+		return b.Reply(msg, ping{N: p.N + 1})
+	})
+	listen(t, b, queue)
+
+	msg, err := bus.NewMessage(ping{N: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := b.Request(msg, func(request *bus.Message) error {
+		return b.Publish(context.Background(), topic, "", request)
+	}, waitTimeout)
+	if err != nil {
+		t.Fatalf("request: %s", err)
+	}
+	if reply.CausationID != msg.ID || reply.CorrelationID != msg.CorrelationID {
+		t.Errorf("got causation=%s correlation=%s, want causation=%s correlation=%s", reply.CausationID, reply.CorrelationID, msg.ID, msg.CorrelationID)
+	}
+	var p ping
+	err = json.Unmarshal(reply.Data, &p)
+	if err != nil || p.N != 2 {
+		t.Errorf("got reply %s, want n=2", reply.Data)
+	}
+}
+
+func mustBind(t *testing.T, b bus.Bus, topic, key, queue string) {
+	t.Helper()
+	err := b.Bind(topic, key, queue)
+	if err != nil {
+		t.Fatalf("bind: %s", err)
+	}
+}
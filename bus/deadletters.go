@@ -0,0 +1,25 @@
+package bus
+
+import "time"
+
+// DeadLetter is a message a queue gave up on, after its handler failed
+// permanently or too many times.
+type DeadLetter struct {
+	MessageID      string    `json:"message_id"`
+	Type           string    `json:"type"`
+	Version        int       `json:"version"`
+	CorrelationID  string    `json:"correlation_id"`
+	Data           []byte    `json:"data"`
+	Attempts       int       `json:"attempts"`
+	LastError      string    `json:"last_error"`
+	OriginalQueue  string    `json:"original_queue"`
+	DeadLetteredAt time.Time `json:"dead_lettered_at"`
+}
+
+type DeadLetters interface {
+	// Peek returns up to limit dead letters of queue without removing them.
+	Peek(queue string, limit int) ([]*DeadLetter, error)
+	// Replay moves up to limit dead letters back to queue with their
+	// attempts reset and returns how many were moved.
+	Replay(queue string, limit int) (int, error)
+}
@@ -0,0 +1,41 @@
+package bus
+
+import "errors"
+
+var (
+	// ErrNotRouted is returned by Publish when no queue is bound for the
+	// topic and key.
+	ErrNotRouted = errors.New("bus: message not routed")
+	// ErrUnavailable is wrapped by the errors of a transport that can't
+	// reach its broker.
+	ErrUnavailable    = errors.New("bus: unavailable")
+	ErrClosed         = errors.New("bus: closed")
+	ErrRequestTimeout = errors.New("bus: request timeout")
+)
+
+// ErrPermanent marks handler errors that retrying can't fix. Such messages
+// are not redelivered.
+var ErrPermanent = errors.New("permanent failure")
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+func (e *permanentError) Is(target error) bool {
+	return target == ErrPermanent
+}
+
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
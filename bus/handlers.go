@@ -0,0 +1,82 @@
+package bus
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Upcaster converts the data of a message from one version to the next.
+type Upcaster func(data []byte) ([]byte, error)
+
+// Handlers is where consumers register what they handle.
+type Handlers interface {
+	HandleFunc(name string, version int, handler func(msg *Message) error)
+	Upcast(name string, from int, upcaster Upcaster)
+}
+
+type handler struct {
+	version int
+	fn      func(msg *Message) error
+}
+
+// Registry is the Handlers implementation shared by the transports.
+type Registry struct {
+	mu        sync.RWMutex
+	handlers  map[string]*handler
+	upcasters map[string]map[int]Upcaster
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		handlers:  make(map[string]*handler),
+		upcasters: make(map[string]map[int]Upcaster),
+	}
+}
+
+// HandleFunc registers the handler of the messages named name. Messages of
+// older versions are upcast to version before being handled.
+func (r *Registry) HandleFunc(name string, version int, fn func(msg *Message) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[name] = &handler{version: version, fn: fn}
+}
+
+// Upcast registers the conversion of the messages named name from version
+// from to from+1.
+func (r *Registry) Upcast(name string, from int, upcaster Upcaster) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.upcasters[name] == nil {
+		r.upcasters[name] = make(map[int]Upcaster)
+	}
+	r.upcasters[name][from] = upcaster
+}
+
+// Dispatch upcasts msg to the version of its handler and runs it. Messages
+// that can't be handled fail with a permanent error.
+func (r *Registry) Dispatch(msg *Message) error {
+	r.mu.RLock()
+	h, ok := r.handlers[msg.Type]
+	upcasters := r.upcasters[msg.Type]
+	r.mu.RUnlock()
+
+	if !ok {
+		return Permanent(fmt.Errorf("received message without registered handler: MessageType=%s", msg.Type))
+	}
+	if msg.Version > h.version {
+		return Permanent(fmt.Errorf("%w: %s v%d, handler is v%d", ErrUnknownVersion, msg.Type, msg.Version, h.version))
+	}
+	for msg.Version < h.version {
+		upcaster, ok := upcasters[msg.Version]
+		if !ok {
+			return Permanent(fmt.Errorf("%w: no upcaster for %s v%d", ErrUnknownVersion, msg.Type, msg.Version))
+		}
+		data, err := upcaster(msg.Data)
+		if err != nil {
+			return Permanent(err)
+		}
+		msg.Data = data
+		msg.Version++
+	}
+	return h.fn(msg)
+}
@@ -0,0 +1,372 @@
+// Package memory is an in-process bus for tests and single-binary
+// deployments. Messages are kept in memory only and are lost on exit.
+package memory
+
+import (
+	"context"
+	"errors"
+	"go-temporal-workflow/bus"
+	"go-temporal-workflow/logging"
+	"sync"
+	"time"
+)
+
+// Options controls redelivery. A message whose handler fails is handled
+// again after RetryDelay by the same worker, so later messages with its key
+// wait for it, up to MaxAttempts deliveries in total, then it is
+// dead-lettered. The defaults match the AMQP transport without retry queues:
+// one redelivery.
+type Options struct {
+	MaxAttempts int
+	RetryDelay  time.Duration
+}
+
+func DefaultOptions() *Options {
+	return &Options{
+		MaxAttempts: 2,
+	}
+}
+
+// replyTo marks requests, replies never leave the process.
+const replyTo = "memory"
+
+type delivery struct {
+	msg       bus.Message
+	attempts  int
+	lastError string
+	deadAt    time.Time
+}
+
+type queue struct {
+	name       string
+	mu         sync.Mutex
+	deliveries []*delivery
+	dead       []*delivery
+	ready      chan struct{}
+}
+
+func newQueue(name string) *queue {
+	return &queue{name: name, ready: make(chan struct{}, 1)}
+}
+
+func (q *queue) push(d *delivery) {
+	q.mu.Lock()
+	q.deliveries = append(q.deliveries, d)
+	q.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// requeue puts d back at the head of the queue.
+func (q *queue) requeue(d *delivery) {
+	q.mu.Lock()
+	q.deliveries = append([]*delivery{d}, q.deliveries...)
+	q.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (q *queue) pop() (*delivery, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.deliveries) == 0 {
+		return nil, false
+	}
+	d := q.deliveries[0]
+	q.deliveries = q.deliveries[1:]
+	if len(q.deliveries) > 0 {
+		// wake the next listener
+		select {
+		case q.ready <- struct{}{}:
+		default:
+		}
+	}
+	return d, true
+}
+
+func (q *queue) deadLetter(d *delivery, cause error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	d.lastError = cause.Error()
+	d.deadAt = time.Now().UTC()
+	q.dead = append(q.dead, d)
+}
+
+type memoryBus struct {
+	*bus.Registry
+	opts    *Options
+	replies *bus.Replies
+
+	mu        sync.Mutex
+	bindings  map[string]map[string][]string
+	queues    map[string]*queue
+	closed    bool
+	stopping  chan struct{}
+	stopOnce  sync.Once
+	listeners sync.WaitGroup
+}
+
+func New(opts *Options) bus.Bus {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	return &memoryBus{
+		Registry: bus.NewRegistry(),
+		opts:     opts,
+		replies:  bus.NewReplies(),
+		bindings: make(map[string]map[string][]string),
+		queues:   make(map[string]*queue),
+		stopping: make(chan struct{}),
+	}
+}
+
+func (b *memoryBus) Bind(topic, key, queueName string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.bindings[topic] == nil {
+		b.bindings[topic] = make(map[string][]string)
+	}
+	for _, name := range b.bindings[topic][key] {
+		if name == queueName {
+			return nil
+		}
+	}
+	b.bindings[topic][key] = append(b.bindings[topic][key], queueName)
+	b.queue(queueName)
+	return nil
+}
+
+// queue must be called with the lock held.
+func (b *memoryBus) queue(name string) *queue {
+	q, ok := b.queues[name]
+	if !ok {
+		q = newQueue(name)
+		b.queues[name] = q
+	}
+	return q
+}
+
+// Publish copies the message into every queue bound to the topic with key.
+func (b *memoryBus) Publish(_ context.Context, topic, key string, msg *bus.Message) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return bus.ErrClosed
+	}
+	var queues []*queue
+	for _, name := range b.bindings[topic][key] {
+		queues = append(queues, b.queues[name])
+	}
+	b.mu.Unlock()
+
+	if len(queues) == 0 {
+		return bus.ErrNotRouted
+	}
+	for _, q := range queues {
+		d := &delivery{msg: *msg}
+		d.msg.Data = append([]byte(nil), msg.Data...)
+		q.push(d)
+	}
+	return nil
+}
+
+func (b *memoryBus) Listen(queueName string, opts *bus.ListenOptions) error {
+	if opts == nil {
+		opts = &bus.ListenOptions{}
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return bus.ErrClosed
+	}
+	q := b.queue(queueName)
+	b.listeners.Add(1)
+	b.mu.Unlock()
+	defer b.listeners.Done()
+
+	pool := bus.NewWorkerPool(opts.Workers, 0)
+	defer pool.Drain()
+
+	for {
+		select {
+		case <-b.stopping:
+			return nil
+		case <-q.ready:
+		}
+		for {
+			d, ok := q.pop()
+			if !ok {
+				break
+			}
+			key := ""
+			if opts.KeyFunc != nil {
+				key = opts.KeyFunc(&d.msg)
+			}
+			pool.Submit(key, func() {
+				b.handle(q, d)
+			})
+			select {
+			case <-b.stopping:
+				return nil
+			default:
+			}
+		}
+	}
+}
+
+// handle retries a failed message on the worker of its key, which holds back
+// the later messages with the same key until it succeeds or is
+// dead-lettered.
+func (b *memoryBus) handle(q *queue, d *delivery) {
+	logger := logging.Default().With("message_id", d.msg.ID, "type", d.msg.Type, logging.RequestIDKey, d.msg.RequestID)
+	for {
+		d.attempts++
+		msg := d.msg
+		err := b.Dispatch(&msg)
+		if err == nil {
+			return
+		}
+
+		logger.Error("error on handle message", "err", err)
+		if errors.Is(err, bus.ErrPermanent) || d.attempts >= b.opts.MaxAttempts {
+			logger.Warn("message dead-lettered", "attempts", d.attempts)
+			q.deadLetter(d, err)
+			return
+		}
+		if !b.sleep(b.opts.RetryDelay) {
+			// stopping, keep it for the next listener
+			q.requeue(d)
+			return
+		}
+	}
+}
+
+// sleep waits for delay and reports false when the bus stops first.
+func (b *memoryBus) sleep(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-b.stopping:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// Request waits for the reply in process, ReplyTo only marks the request as
+// expecting one.
+func (b *memoryBus) Request(msg *bus.Message, send func(msg *bus.Message) error, timeout time.Duration) (*bus.Message, error) {
+	request := *msg
+	request.ReplyTo = replyTo
+
+	reply := b.replies.Add(request.ID)
+	defer b.replies.Remove(request.ID)
+
+	err := send(&request)
+	if err != nil {
+		return nil, err
+	}
+	return bus.Wait(reply, timeout)
+}
+
+func (b *memoryBus) Reply(request *bus.Message, v interface{}) error {
+	if request.ReplyTo == "" {
+		return nil
+	}
+	msg, err := bus.NewMessageFrom(request, v)
+	if err != nil {
+		return err
+	}
+	if !b.replies.Resolve(msg) {
+		logging.Default().Warn("reply without waiting request", "causation_id", msg.CausationID)
+	}
+	return nil
+}
+
+func (b *memoryBus) Peek(queueName string, limit int) ([]*bus.DeadLetter, error) {
+	b.mu.Lock()
+	q, ok := b.queues[queueName]
+	b.mu.Unlock()
+	letters := make([]*bus.DeadLetter, 0)
+	if !ok {
+		return letters, nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, d := range q.dead {
+		if len(letters) >= limit {
+			break
+		}
+		letters = append(letters, &bus.DeadLetter{
+			MessageID:      d.msg.ID,
+			Type:           d.msg.Type,
+			Version:        d.msg.Version,
+			CorrelationID:  d.msg.CorrelationID,
+			Data:           d.msg.Data,
+			Attempts:       d.attempts,
+			LastError:      d.lastError,
+			OriginalQueue:  q.name,
+			DeadLetteredAt: d.deadAt,
+		})
+	}
+	return letters, nil
+}
+
+func (b *memoryBus) Replay(queueName string, limit int) (int, error) {
+	b.mu.Lock()
+	q, ok := b.queues[queueName]
+	b.mu.Unlock()
+	if !ok {
+		return 0, nil
+	}
+
+	q.mu.Lock()
+	n := limit
+	if n > len(q.dead) {
+		n = len(q.dead)
+	}
+	replayed := q.dead[:n]
+	q.dead = q.dead[n:]
+	q.mu.Unlock()
+
+	for _, d := range replayed {
+		d.attempts = 0
+		d.lastError = ""
+		q.push(d)
+	}
+	return n, nil
+}
+
+// Stop stops the listeners and waits for the handlers already running.
+// Messages still queued stay in their queue.
+func (b *memoryBus) Stop(ctx context.Context) error {
+	b.stopOnce.Do(func() {
+		close(b.stopping)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		b.listeners.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *memoryBus) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	return b.Stop(context.Background())
+}
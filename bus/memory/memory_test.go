@@ -0,0 +1,89 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"go-temporal-workflow/bus"
+	"go-temporal-workflow/bus/bustest"
+	"go-temporal-workflow/bus/memory"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConformance(t *testing.T) {
+	bustest.Run(t, func(t *testing.T) bus.Bus {
+		return memory.New(nil)
+	})
+}
+
+func TestDeadLetters(t *testing.T) {
+	bus.RegisterType("memory_test.fail", 1, struct{}{})
+
+	b := memory.New(&memory.Options{MaxAttempts: 2})
+	defer func() {
+		_ = b.Close()
+	}()
+	err := b.Bind("topic", "", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	attempts := 0
+	b.HandleFunc("memory_test.fail", 1, func(msg *bus.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts <= 2 {
+			return errors.New("fails twice")
+		}
+		return nil
+	})
+	go func() {
+		_ = b.Listen("queue", nil)
+	}()
+
+	msg, err := bus.NewMessage(struct{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Publish(context.Background(), "topic", "", msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var letters []*bus.DeadLetter
+	deadline := time.Now().Add(5 * time.Second)
+	for len(letters) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		letters, err = b.Peek("queue", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(letters) != 1 || letters[0].MessageID != msg.ID || letters[0].Attempts != 2 || letters[0].LastError != "fails twice" {
+		t.Fatalf("got dead letters %+v, want %s after 2 attempts", letters, msg.ID)
+	}
+
+	replayed, err := b.Replay("queue", 10)
+	if err != nil || replayed != 1 {
+		t.Fatalf("replay: got %d, %v, want 1", replayed, err)
+	}
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		done := attempts == 3
+		mu.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	got := attempts
+	mu.Unlock()
+	letters, _ = b.Peek("queue", 10)
+	if got != 3 || len(letters) != 0 {
+		t.Fatalf("got %d attempts and %d dead letters after replay, want 3 and 0", got, len(letters))
+	}
+}
@@ -0,0 +1,113 @@
+package bus
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnregisteredType = errors.New("message type not registered")
+	ErrUnknownVersion   = errors.New("unknown message version")
+)
+
+// Message is the envelope of every message on the bus. CorrelationID is
+// shared by every message caused by the same request and CausationID is the
+// ID of the message that caused this one. RequestID is the ID of the HTTP
+// request at the origin, for the logs. Transports carry the fields next to
+// the data, in properties or headers.
+type Message struct {
+	ID            string
+	Type          string
+	Version       int
+	Timestamp     time.Time
+	CorrelationID string
+	CausationID   string
+	RequestID     string
+	ReplyTo       string
+	Data          []byte
+}
+
+type registeredType struct {
+	name    string
+	version int
+}
+
+var registry = struct {
+	sync.RWMutex
+	types  map[reflect.Type]registeredType
+	legacy map[string]registeredType
+}{
+	types:  make(map[reflect.Type]registeredType),
+	legacy: make(map[string]registeredType),
+}
+
+// RegisterType gives the Go type of v a stable name and the schema version
+// it is published with. Renaming the Go type doesn't change the wire format.
+func RegisterType(name string, version int, v interface{}) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.types[reflect.TypeOf(v)] = registeredType{name: name, version: version}
+	// messages published before the envelope carry the Go type name
+	registry.legacy[fmt.Sprintf("%T", v)] = registeredType{name: name, version: 1}
+}
+
+// LegacyType returns the registered name of a Go type name, as published
+// before messages had registered names. Legacy messages are version 1.
+func LegacyType(goType string) (string, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	rt, ok := registry.legacy[goType]
+	return rt.name, ok
+}
+
+// NewMessage wraps m in a new envelope, starting a new correlation. The type
+// of m must be registered with RegisterType.
+func NewMessage(m interface{}) (*Message, error) {
+	registry.RLock()
+	rt, ok := registry.types[reflect.TypeOf(m)]
+	registry.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrUnregisteredType, m)
+	}
+	body, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	id := NewID()
+	return &Message{
+		ID:            id,
+		Type:          rt.name,
+		Version:       rt.version,
+		Timestamp:     time.Now().UTC(),
+		CorrelationID: id,
+		Data:          body,
+	}, nil
+}
+
+// NewMessageFrom wraps m in a new envelope caused by cause, keeping its
+// correlation.
+func NewMessageFrom(cause *Message, m interface{}) (*Message, error) {
+	msg, err := NewMessage(m)
+	if err != nil {
+		return nil, err
+	}
+	msg.CorrelationID = cause.CorrelationID
+	msg.CausationID = cause.ID
+	msg.RequestID = cause.RequestID
+	return msg, nil
+}
+
+func NewID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,58 @@
+package bus
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// WorkerPool runs tasks on a fixed number of goroutines. Tasks with the same
+// key always run on the same worker, so they run one at a time in the order
+// they were submitted, while tasks with different keys run in parallel.
+type WorkerPool struct {
+	queues []chan func()
+	next   uint32
+	wg     sync.WaitGroup
+}
+
+func NewWorkerPool(size, buffer int) *WorkerPool {
+	if size < 1 {
+		size = 1
+	}
+	p := &WorkerPool{queues: make([]chan func(), size)}
+	for i := range p.queues {
+		queue := make(chan func(), buffer)
+		p.queues[i] = queue
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for task := range queue {
+				task()
+			}
+		}()
+	}
+	return p
+}
+
+// Submit queues the task on the worker owning key, blocking while that
+// worker is busy. Tasks without a key are spread over the workers.
+func (p *WorkerPool) Submit(key string, task func()) {
+	p.queues[p.worker(key)] <- task
+}
+
+func (p *WorkerPool) worker(key string) int {
+	if key == "" {
+		p.next++
+		return int(p.next % uint32(len(p.queues)))
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
+
+// Drain stops accepting tasks and waits for the queued ones to finish.
+func (p *WorkerPool) Drain() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.wg.Wait()
+}
@@ -0,0 +1,61 @@
+package bus
+
+import (
+	"sync"
+	"time"
+)
+
+// Replies matches replies to the requests waiting for them. A reply is
+// matched by its causation id, the message id of the request. It is shared
+// by the transports.
+type Replies struct {
+	mu      sync.Mutex
+	waiting map[string]chan *Message
+}
+
+func NewReplies() *Replies {
+	return &Replies{waiting: make(map[string]chan *Message)}
+}
+
+// Add registers the request id. Requests must be registered before they are
+// published, or a fast reply finds nobody waiting.
+func (r *Replies) Add(id string) <-chan *Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reply := make(chan *Message, 1)
+	r.waiting[id] = reply
+	return reply
+}
+
+func (r *Replies) Remove(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.waiting, id)
+}
+
+// Resolve hands msg to the request it answers. It reports false when no
+// request waits for it, because it timed out or was made by another process.
+func (r *Replies) Resolve(msg *Message) bool {
+	r.mu.Lock()
+	reply, ok := r.waiting[msg.CausationID]
+	delete(r.waiting, msg.CausationID)
+	r.mu.Unlock()
+
+	if ok {
+		reply <- msg
+	}
+	return ok
+}
+
+// Wait waits up to timeout for reply.
+func Wait(reply <-chan *Message, timeout time.Duration) (*Message, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case msg := <-reply:
+		return msg, nil
+	case <-timer.C:
+		return nil, ErrRequestTimeout
+	}
+}
@@ -0,0 +1,391 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"go-temporal-workflow/db"
+	"go-temporal-workflow/logging"
+	"go-temporal-workflow/rmq"
+	"go-temporal-workflow/temporalclient"
+	"go.temporal.io/sdk/client"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config is the configuration of every process. Each field is read from the
+// YAML file key in its yaml tag, the environment variable in its env tag and
+// the command line flag in its flag tag, later sources taking precedence.
+// Fields tagged secret also accept the path of a file holding the value, with
+// the _file suffix on the key and flag and _FILE on the variable.
+type Config struct {
+	API      API      `yaml:"api"`
+	MongoDB  MongoDB  `yaml:"mongodb"`
+	RabbitMQ RabbitMQ `yaml:"rabbitmq"`
+	Bus      Bus      `yaml:"bus"`
+	Temporal Temporal `yaml:"temporal"`
+	Security Security `yaml:"security"`
+	Log      Log      `yaml:"log"`
+
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" flag:"shutdown_timeout" usage:"set how long shutdown waits for in-flight work"`
+}
+
+type API struct {
+	Port          int           `yaml:"port" env:"API_PORT" flag:"api_port" usage:"set api port"`
+	ReadTimeout   time.Duration `yaml:"read_timeout" env:"API_READ_TIMEOUT" flag:"api_read_timeout" usage:"set how long reading a request may take, 0 for no limit"`
+	WriteTimeout  time.Duration `yaml:"write_timeout" env:"API_WRITE_TIMEOUT" flag:"api_write_timeout" usage:"set how long writing a response may take, 0 for no limit"`
+	IdleTimeout   time.Duration `yaml:"idle_timeout" env:"API_IDLE_TIMEOUT" flag:"api_idle_timeout" usage:"set how long keep-alive connections stay open"`
+	BodyLimit     int           `yaml:"body_limit" env:"API_BODY_LIMIT" flag:"api_body_limit" usage:"set the max request body size in bytes"`
+	BalancePolicy string        `yaml:"account_balance_policy" env:"ACCOUNT_BALANCE_POLICY" flag:"account_balance_policy" usage:"record the balance of deleted accounts as a refund or forfeit, refunds are not paid out"`
+}
+
+type MongoDB struct {
+	URI        string `yaml:"uri" env:"MONGODB_URI" flag:"mongodb_uri" secret:"true" usage:"mongodb connection string, overrides user, pass, host and port"`
+	User       string `yaml:"user" env:"MONGODB_USER" flag:"mongodb_user" usage:"mongodb user"`
+	Pass       string `yaml:"pass" env:"MONGODB_PASS" flag:"mongodb_pass" secret:"true" usage:"mongodb password"`
+	Host       string `yaml:"host" env:"MONGODB_HOST" flag:"mongodb_host" usage:"mongodb host, or comma separated host:port list"`
+	Port       int    `yaml:"port" env:"MONGODB_PORT" flag:"mongodb_port" usage:"mongodb port"`
+	Name       string `yaml:"name" env:"MONGODB_NAME" flag:"mongodb_name" usage:"mongodb database name"`
+	AuthSource string `yaml:"auth_source" env:"MONGODB_AUTH_SOURCE" flag:"mongodb_auth_source" usage:"mongodb authentication database, defaults to the database name"`
+	ReplicaSet string `yaml:"replica_set" env:"MONGODB_REPLICA_SET" flag:"mongodb_replica_set" usage:"mongodb replica set name"`
+
+	TLS         bool   `yaml:"tls" env:"MONGODB_TLS" flag:"mongodb_tls" usage:"connect to mongodb with tls"`
+	TLSCAFile   string `yaml:"tls_ca_file" env:"MONGODB_TLS_CA_FILE" flag:"mongodb_tls_ca_file" usage:"pem file with the ca certificates to trust"`
+	TLSCertFile string `yaml:"tls_cert_file" env:"MONGODB_TLS_CERT_FILE" flag:"mongodb_tls_cert_file" usage:"pem file with the client certificate and key"`
+	TLSInsecure bool   `yaml:"tls_insecure" env:"MONGODB_TLS_INSECURE" flag:"mongodb_tls_insecure" usage:"skip verification of the mongodb server certificate"`
+
+	MaxPoolSize            uint64        `yaml:"max_pool_size" env:"MONGODB_MAX_POOL_SIZE" flag:"mongodb_max_pool_size" usage:"max connections per server, 0 keeps the driver default"`
+	MinPoolSize            uint64        `yaml:"min_pool_size" env:"MONGODB_MIN_POOL_SIZE" flag:"mongodb_min_pool_size" usage:"min connections per server"`
+	MaxConnIdleTime        time.Duration `yaml:"max_conn_idle_time" env:"MONGODB_MAX_CONN_IDLE_TIME" flag:"mongodb_max_conn_idle_time" usage:"close pooled connections idle for longer"`
+	ConnectTimeout         time.Duration `yaml:"connect_timeout" env:"MONGODB_CONNECT_TIMEOUT" flag:"mongodb_connect_timeout" usage:"timeout to open a connection"`
+	ServerSelectionTimeout time.Duration `yaml:"server_selection_timeout" env:"MONGODB_SERVER_SELECTION_TIMEOUT" flag:"mongodb_server_selection_timeout" usage:"timeout to find a suitable server for an operation"`
+	SocketTimeout          time.Duration `yaml:"socket_timeout" env:"MONGODB_SOCKET_TIMEOUT" flag:"mongodb_socket_timeout" usage:"timeout for reads and writes on a connection"`
+}
+
+type RabbitMQ struct {
+	User  string `yaml:"user" env:"RABBITMQ_USER" flag:"rmq_user" usage:"rabbitmq user"`
+	Pass  string `yaml:"pass" env:"RABBITMQ_PASS" flag:"rmq_pass" secret:"true" usage:"rabbitmq password"`
+	Host  string `yaml:"host" env:"RABBITMQ_HOST" flag:"rmq_host" usage:"rabbitmq host"`
+	Port  int    `yaml:"port" env:"RABBITMQ_PORT" flag:"rmq_port" usage:"rabbitmq port"`
+	VHost string `yaml:"vhost" env:"RABBITMQ_VHOST" flag:"rmq_vhost" usage:"rabbitmq virtual host"`
+}
+
+// Transports of the bus. With the memory transport the api consumes the
+// subscription commands itself and no rabbitmq is needed.
+const (
+	TransportAMQP   = "amqp"
+	TransportMemory = "memory"
+)
+
+type Bus struct {
+	Transport string `yaml:"transport" env:"BUS_TRANSPORT" flag:"bus_transport" usage:"amqp, or memory to run the api and the subscriptions consumer in one process without rabbitmq"`
+}
+
+type Temporal struct {
+	HostPort  string `yaml:"host_port" env:"TEMPORAL_HOST_PORT" flag:"temporal_host_port" usage:"temporal frontend address"`
+	Namespace string `yaml:"namespace" env:"TEMPORAL_NAMESPACE" flag:"temporal_namespace" usage:"temporal namespace"`
+	Identity  string `yaml:"identity" env:"TEMPORAL_IDENTITY" flag:"temporal_identity" usage:"client identity shown in workflow histories, defaults to pid@host"`
+	LogLevel  string `yaml:"log_level" env:"TEMPORAL_LOG_LEVEL" flag:"temporal_log_level" usage:"level of the temporal sdk logs: debug, info, warn or error"`
+
+	TLS           bool   `yaml:"tls" env:"TEMPORAL_TLS" flag:"temporal_tls" usage:"connect to temporal with tls"`
+	TLSCAFile     string `yaml:"tls_ca_file" env:"TEMPORAL_TLS_CA_FILE" flag:"temporal_tls_ca_file" usage:"pem file with the ca certificates to trust"`
+	TLSCertFile   string `yaml:"tls_cert_file" env:"TEMPORAL_TLS_CERT_FILE" flag:"temporal_tls_cert_file" usage:"pem file with the client certificate for mtls"`
+	TLSKeyFile    string `yaml:"tls_key_file" env:"TEMPORAL_TLS_KEY_FILE" flag:"temporal_tls_key_file" usage:"pem file with the client key for mtls"`
+	TLSServerName string `yaml:"tls_server_name" env:"TEMPORAL_TLS_SERVER_NAME" flag:"temporal_tls_server_name" usage:"server name to verify the temporal certificate against"`
+	TLSInsecure   bool   `yaml:"tls_insecure" env:"TEMPORAL_TLS_INSECURE" flag:"temporal_tls_insecure" usage:"skip verification of the temporal server certificate"`
+
+	RegisterNamespace  bool          `yaml:"register_namespace" env:"TEMPORAL_REGISTER_NAMESPACE" flag:"temporal_register_namespace" usage:"register the namespace on startup when it is missing"`
+	NamespaceRetention time.Duration `yaml:"namespace_retention" env:"TEMPORAL_NAMESPACE_RETENTION" flag:"temporal_namespace_retention" usage:"workflow retention of a registered namespace"`
+
+	EncryptionKeys  string `yaml:"encryption_keys" env:"TEMPORAL_ENCRYPTION_KEYS" flag:"temporal_encryption_keys" secret:"true" usage:"comma separated id:base64key pairs payloads are encrypted with"`
+	EncryptionKeyID string `yaml:"encryption_key_id" env:"TEMPORAL_ENCRYPTION_KEY_ID" flag:"temporal_encryption_key_id" usage:"id of the key new payloads are encrypted with"`
+	Compress        bool   `yaml:"compress" env:"TEMPORAL_COMPRESS" flag:"temporal_compress" usage:"gzip payloads before they are sent to temporal"`
+
+	EncryptionDisabled bool `yaml:"encryption_disabled" env:"TEMPORAL_ENCRYPTION_DISABLED" flag:"temporal_encryption_disabled" usage:"send payloads to temporal unencrypted"`
+}
+
+type Security struct {
+	JWTSecretKey         string `yaml:"jwt_secret_key" env:"JWT_SECRET_KEY" flag:"jwt_secret_key" secret:"true" usage:"key access tokens are signed with"`
+	SecretsEncryptionKey string `yaml:"secrets_encryption_key" env:"SECRETS_ENCRYPTION_KEY" flag:"secrets_encryption_key" secret:"true" usage:"key mfa secrets are encrypted with"`
+	PasswordMinLength    int    `yaml:"password_min_length" env:"PASSWORD_MIN_LENGTH" flag:"password_min_length" usage:"minimum password length"`
+	PasswordMaxLength    int    `yaml:"password_max_length" env:"PASSWORD_MAX_LENGTH" flag:"password_max_length" usage:"maximum password length"`
+}
+
+type Log struct {
+	Level string `yaml:"level" env:"LOG_LEVEL" flag:"log_level" usage:"level of the service logs: debug, info, warn or error"`
+}
+
+func Default() *Config {
+	return &Config{
+		API: API{
+			Port:          8080,
+			BodyLimit:     fiber.DefaultBodyLimit,
+			BalancePolicy: "refund",
+		},
+		MongoDB: MongoDB{
+			User: "ungame",
+			Pass: "secret",
+			Host: "localhost",
+			Port: 27017,
+			Name: "workflows",
+		},
+		RabbitMQ: RabbitMQ{
+			User: "guest",
+			Pass: "guest",
+			Host: "localhost",
+			Port: 5672,
+		},
+		Bus: Bus{
+			Transport: TransportAMQP,
+		},
+		Temporal: Temporal{
+			HostPort:           client.DefaultHostPort,
+			Namespace:          client.DefaultNamespace,
+			LogLevel:           "info",
+			NamespaceRetention: 72 * time.Hour,
+		},
+		Security: Security{
+			PasswordMinLength: 8,
+			PasswordMaxLength: 128,
+		},
+		Log: Log{
+			Level: "info",
+		},
+		ShutdownTimeout: 30 * time.Second,
+	}
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []string
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	check(c.API.Validate())
+	check(c.MongoDB.Validate())
+	check(c.Bus.Validate())
+	if c.Bus.Transport == TransportAMQP {
+		check(c.RabbitMQ.Validate())
+	}
+	check(c.Temporal.Validate())
+	check(c.Security.Validate())
+	check(c.Log.Validate())
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, "shutdown_timeout must be positive")
+	}
+	if len(errs) > 0 {
+		return errors.New("invalid config: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (c API) Validate() error {
+	var errs []string
+	if !validPort(c.Port) {
+		errs = append(errs, fmt.Sprintf("api.port %d out of range", c.Port))
+	}
+	if c.ReadTimeout < 0 || c.WriteTimeout < 0 || c.IdleTimeout < 0 {
+		errs = append(errs, "api timeouts must not be negative")
+	}
+	if c.BodyLimit <= 0 {
+		errs = append(errs, "api.body_limit must be positive")
+	}
+	if c.BalancePolicy != "refund" && c.BalancePolicy != "forfeit" {
+		errs = append(errs, fmt.Sprintf("api.account_balance_policy %q must be refund or forfeit", c.BalancePolicy))
+	}
+	return joinErrors(errs)
+}
+
+func (c MongoDB) Validate() error {
+	var errs []string
+	if c.URI == "" {
+		if c.Host == "" {
+			errs = append(errs, "mongodb.host or mongodb.uri is required")
+		}
+		if !validPort(c.Port) {
+			errs = append(errs, fmt.Sprintf("mongodb.port %d out of range", c.Port))
+		}
+	}
+	if c.Name == "" && c.URI == "" {
+		errs = append(errs, "mongodb.name is required")
+	}
+	if c.MinPoolSize > 0 && c.MaxPoolSize > 0 && c.MinPoolSize > c.MaxPoolSize {
+		errs = append(errs, "mongodb.min_pool_size is above mongodb.max_pool_size")
+	}
+	if c.MaxConnIdleTime < 0 || c.ConnectTimeout < 0 || c.ServerSelectionTimeout < 0 || c.SocketTimeout < 0 {
+		errs = append(errs, "mongodb timeouts must not be negative")
+	}
+	if len(errs) == 0 {
+		// let the driver check the URI and the TLS files
+		_, err := db.NewConfig(c.ConnectionOptions()).ClientOptions()
+		if err != nil {
+			errs = append(errs, "mongodb: "+err.Error())
+		}
+	}
+	return joinErrors(errs)
+}
+
+func (c RabbitMQ) Validate() error {
+	var errs []string
+	if c.Host == "" {
+		errs = append(errs, "rabbitmq.host is required")
+	}
+	if !validPort(c.Port) {
+		errs = append(errs, fmt.Sprintf("rabbitmq.port %d out of range", c.Port))
+	}
+	return joinErrors(errs)
+}
+
+func (c Bus) Validate() error {
+	if c.Transport != TransportAMQP && c.Transport != TransportMemory {
+		return fmt.Errorf("bus.transport %q must be amqp or memory", c.Transport)
+	}
+	return nil
+}
+
+func (c Temporal) Validate() error {
+	var errs []string
+	if c.HostPort == "" {
+		errs = append(errs, "temporal.host_port is required")
+	}
+	if c.Namespace == "" {
+		errs = append(errs, "temporal.namespace is required")
+	}
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		errs = append(errs, "temporal.log_level: "+err.Error())
+	}
+	if c.RegisterNamespace && c.NamespaceRetention < 24*time.Hour {
+		errs = append(errs, "temporal.namespace_retention must be at least 24h")
+	}
+	if c.EncryptionKeys == "" && !c.EncryptionDisabled {
+		errs = append(errs, "temporal.encryption_keys is required unless temporal.encryption_disabled is set")
+	}
+	if c.EncryptionKeyID != "" && c.EncryptionKeys == "" {
+		errs = append(errs, "temporal.encryption_key_id is set without temporal.encryption_keys")
+	}
+	if c.EncryptionKeys != "" && c.EncryptionKeyID == "" {
+		errs = append(errs, "temporal.encryption_key_id is required with temporal.encryption_keys")
+	}
+	if c.EncryptionDisabled && c.EncryptionKeys != "" {
+		errs = append(errs, "temporal.encryption_keys is set with temporal.encryption_disabled")
+	}
+	if len(errs) == 0 {
+		// load the certificates and keys now rather than on the first connection
+		_, err := temporalclient.NewConfig(c.ConnectionOptions()).ClientOptions()
+		if err != nil {
+			errs = append(errs, "temporal: "+err.Error())
+		}
+	}
+	return joinErrors(errs)
+}
+
+func (c Security) Validate() error {
+	var errs []string
+	if c.JWTSecretKey == "" {
+		errs = append(errs, "security.jwt_secret_key is required")
+	}
+	if c.SecretsEncryptionKey == "" {
+		errs = append(errs, "security.secrets_encryption_key is required")
+	}
+	if c.PasswordMinLength < 1 {
+		errs = append(errs, "security.password_min_length must be positive")
+	}
+	if c.PasswordMaxLength > 0 && c.PasswordMaxLength < c.PasswordMinLength {
+		errs = append(errs, "security.password_max_length is below security.password_min_length")
+	}
+	return joinErrors(errs)
+}
+
+func (c Log) Validate() error {
+	_, err := logging.ParseLevel(c.Level)
+	if err != nil {
+		return errors.New("log.level: " + err.Error())
+	}
+	return nil
+}
+
+func validPort(port int) bool {
+	return port > 0 && port < 65536
+}
+
+func joinErrors(errs []string) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(errs, "; "))
+}
+
+// Logger returns the JSON logger writing to stderr at the configured level.
+func (c Log) Logger() logging.Logger {
+	level, _ := logging.ParseLevel(c.Level)
+	return logging.New(os.Stderr, level)
+}
+
+func (c API) Addr() string {
+	return fmt.Sprintf(":%d", c.Port)
+}
+
+func (c API) Fiber() fiber.Config {
+	return fiber.Config{
+		ReadTimeout:  c.ReadTimeout,
+		WriteTimeout: c.WriteTimeout,
+		IdleTimeout:  c.IdleTimeout,
+		BodyLimit:    c.BodyLimit,
+	}
+}
+
+func (c MongoDB) ConnectionOptions() *db.ConnectionOptions {
+	return &db.ConnectionOptions{
+		URI:                    c.URI,
+		User:                   c.User,
+		Pass:                   c.Pass,
+		Host:                   c.Host,
+		Port:                   c.Port,
+		Name:                   c.Name,
+		AuthSource:             c.AuthSource,
+		ReplicaSet:             c.ReplicaSet,
+		TLS:                    c.TLS,
+		TLSCAFile:              c.TLSCAFile,
+		TLSCertFile:            c.TLSCertFile,
+		TLSInsecure:            c.TLSInsecure,
+		MaxPoolSize:            c.MaxPoolSize,
+		MinPoolSize:            c.MinPoolSize,
+		MaxConnIdleTime:        c.MaxConnIdleTime,
+		ConnectTimeout:         c.ConnectTimeout,
+		ServerSelectionTimeout: c.ServerSelectionTimeout,
+		SocketTimeout:          c.SocketTimeout,
+	}
+}
+
+func (c RabbitMQ) ConnectionOptions() *rmq.ConnectionOptions {
+	return &rmq.ConnectionOptions{
+		User:  c.User,
+		Pass:  c.Pass,
+		Host:  c.Host,
+		Port:  c.Port,
+		VHost: c.VHost,
+	}
+}
+
+func (c Temporal) ConnectionOptions() *temporalclient.ConnectionOptions {
+	return &temporalclient.ConnectionOptions{
+		HostPort:           c.HostPort,
+		Namespace:          c.Namespace,
+		Identity:           c.Identity,
+		TLS:                c.TLS,
+		TLSCAFile:          c.TLSCAFile,
+		TLSCertFile:        c.TLSCertFile,
+		TLSKeyFile:         c.TLSKeyFile,
+		TLSServerName:      c.TLSServerName,
+		TLSInsecure:        c.TLSInsecure,
+		RegisterNamespace:  c.RegisterNamespace,
+		NamespaceRetention: c.NamespaceRetention,
+		LogLevel:           c.LogLevel,
+		EncryptionKeys:     c.EncryptionKeys,
+		EncryptionKeyID:    c.EncryptionKeyID,
+		Compress:           c.Compress,
+	}
+}
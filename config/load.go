@@ -0,0 +1,323 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileEnv names the variable holding the config file path when the -config
+// flag is not given.
+const FileEnv = "CONFIG_FILE"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load builds the config from the defaults, the YAML file, the environment
+// and the flags in args, in that order, and validates it. The variables of
+// envFile, when it exists, are loaded first without overriding the ones
+// already set. Flags of the caller can be defined on flagSet beforehand,
+// Load parses it.
+func Load(flagSet *flag.FlagSet, args []string, envFile string) (*Config, error) {
+	cfg, err := load(flagSet, args, envFile)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// LoadUnvalidated is Load without the validation, for commands that only use
+// some sections and validate those themselves.
+func LoadUnvalidated(flagSet *flag.FlagSet, args []string, envFile string) (*Config, error) {
+	return load(flagSet, args, envFile)
+}
+
+func load(flagSet *flag.FlagSet, args []string, envFile string) (*Config, error) {
+	cfg := Default()
+	fields := collect(reflect.ValueOf(cfg).Elem(), nil)
+
+	path := flagSet.String("config", "", "yaml config file, also read from "+FileEnv)
+	flags := make([]*flagValue, 0, len(fields)*2)
+	order := new(int)
+	for _, f := range fields {
+		if f.flag == "" {
+			continue
+		}
+		v := &flagValue{field: f, counter: order, isBool: f.value.Kind() == reflect.Bool}
+		if !f.secret {
+			// secrets are left out of the usage text
+			v.def = format(f.value)
+		}
+		flagSet.Var(v, f.flag, f.usage)
+		flags = append(flags, v)
+		if f.secret {
+			file := &flagValue{field: f, counter: order, fromFile: true}
+			flagSet.Var(file, f.flag+"_file", "file holding "+f.flag)
+			flags = append(flags, file)
+		}
+	}
+	err := flagSet.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if envFile != "" {
+		err = godotenv.Load(envFile)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	if *path == "" {
+		*path = os.Getenv(FileEnv)
+	}
+	if *path != "" {
+		err = loadFile(*path, cfg, fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", *path, err)
+		}
+	}
+
+	for _, f := range fields {
+		if f.env == "" {
+			continue
+		}
+		// empty variables count as unset, .env files often list them blank
+		if s, ok := os.LookupEnv(f.env); ok && s != "" {
+			err = set(f.value, s)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f.env, err)
+			}
+		}
+		if !f.secret {
+			continue
+		}
+		if file, ok := os.LookupEnv(f.env + "_FILE"); ok && file != "" {
+			err = setFromFile(f.value, file)
+			if err != nil {
+				return nil, fmt.Errorf("%s_FILE: %w", f.env, err)
+			}
+		}
+	}
+
+	// flags apply in the order they were given
+	sort.SliceStable(flags, func(i, j int) bool {
+		return flags[i].order < flags[j].order
+	})
+	for _, v := range flags {
+		if v.order == 0 {
+			continue
+		}
+		if v.fromFile {
+			err = setFromFile(v.field.value, v.raw)
+		} else {
+			err = set(v.field.value, v.raw)
+		}
+		if err != nil {
+			name := v.field.flag
+			if v.fromFile {
+				name += "_file"
+			}
+			return nil, fmt.Errorf("-%s: %w", name, err)
+		}
+	}
+	return cfg, nil
+}
+
+// field is a setting of the config with the names it has in each source.
+type field struct {
+	value  reflect.Value
+	yaml   []string
+	env    string
+	flag   string
+	usage  string
+	secret bool
+}
+
+func collect(v reflect.Value, path []string) []*field {
+	var fields []*field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		key := strings.Split(sf.Tag.Get("yaml"), ",")[0]
+		fieldPath := append(append([]string{}, path...), key)
+		if sf.Type.Kind() == reflect.Struct {
+			fields = append(fields, collect(v.Field(i), fieldPath)...)
+			continue
+		}
+		fields = append(fields, &field{
+			value:  v.Field(i),
+			yaml:   fieldPath,
+			env:    sf.Tag.Get("env"),
+			flag:   sf.Tag.Get("flag"),
+			usage:  sf.Tag.Get("usage"),
+			secret: sf.Tag.Get("secret") == "true",
+		})
+	}
+	return fields
+}
+
+// loadFile decodes the YAML file into cfg. Unknown keys are rejected so a
+// typo doesn't silently leave a default in place.
+func loadFile(path string, cfg *Config, fields []*field) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	err = yaml.Unmarshal(data, cfg)
+	if err != nil {
+		return err
+	}
+
+	var tree map[string]interface{}
+	err = yaml.Unmarshal(data, &tree)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool)
+	for _, f := range fields {
+		key := strings.Join(f.yaml, ".")
+		known[key] = true
+		for i := 1; i < len(f.yaml); i++ {
+			known[strings.Join(f.yaml[:i], ".")] = true
+		}
+		if !f.secret {
+			continue
+		}
+		known[key+"_file"] = true
+		if file, ok := lookup(tree, f.yaml, "_file"); ok {
+			err = setFromFile(f.value, file)
+			if err != nil {
+				return fmt.Errorf("%s_file: %w", key, err)
+			}
+		}
+	}
+	var unknown []string
+	walk(tree, "", func(key string) {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	})
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown keys: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+func lookup(tree map[string]interface{}, path []string, suffix string) (string, bool) {
+	node := tree
+	for i, key := range path {
+		if i == len(path)-1 {
+			v, ok := node[key+suffix]
+			if !ok {
+				return "", false
+			}
+			return fmt.Sprint(v), true
+		}
+		next, ok := node[key].(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		node = next
+	}
+	return "", false
+}
+
+func walk(tree map[string]interface{}, prefix string, fn func(key string)) {
+	for key, v := range tree {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		fn(key)
+		if child, ok := v.(map[string]interface{}); ok {
+			walk(child, key, fn)
+		}
+	}
+}
+
+func setFromFile(v reflect.Value, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return set(v, strings.TrimRight(string(data), "\r\n"))
+}
+
+func set(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	default:
+		return errors.New("unsupported config type " + v.Type().String())
+	}
+	return nil
+}
+
+func format(v reflect.Value) string {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// flagValue records a flag while parsing. The value is applied after the
+// file and the environment, so flags win over both.
+type flagValue struct {
+	field    *field
+	def      string
+	raw      string
+	order    int
+	counter  *int
+	isBool   bool
+	fromFile bool
+}
+
+func (v *flagValue) String() string {
+	return v.def
+}
+
+func (v *flagValue) Set(s string) error {
+	*v.counter++
+	v.raw = s
+	v.order = *v.counter
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool {
+	return v.isBool
+}
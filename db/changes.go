@@ -0,0 +1,240 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"go-temporal-workflow/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const resumeTokensCollection = "change_stream_tokens"
+
+const (
+	OperationInsert  = "insert"
+	OperationUpdate  = "update"
+	OperationReplace = "replace"
+	OperationDelete  = "delete"
+)
+
+// the server no longer has the oplog entries the stored token points at
+const (
+	codeChangeStreamFatalError  = 280
+	codeChangeStreamHistoryLost = 286
+)
+
+// ChangeEvent is a write to one of the watched collections. FullDocument is
+// the document as it is after the write, looked up when the event is read,
+// and is empty for deletes.
+type ChangeEvent struct {
+	Operation    string
+	Collection   string
+	DocumentID   interface{}
+	FullDocument bson.Raw
+}
+
+// Decode unmarshals the full document into v.
+func (e *ChangeEvent) Decode(v interface{}) error {
+	if len(e.FullDocument) == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return bson.Unmarshal(e.FullDocument, v)
+}
+
+type changeDocument struct {
+	OperationType string `bson:"operationType"`
+	Namespace     struct {
+		Collection string `bson:"coll"`
+	} `bson:"ns"`
+	DocumentKey struct {
+		ID interface{} `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument bson.Raw `bson:"fullDocument"`
+}
+
+type WatchOptions struct {
+	Collections []string
+	// Reset is called when there is no resume token to continue from, on the
+	// first run or when the stored one is too old. Read models rebuild
+	// themselves from scratch there. Events written meanwhile are delivered
+	// afterwards.
+	Reset func(ctx context.Context) error
+	// RetryDelay is how long the watcher waits before opening the stream
+	// again after an error.
+	RetryDelay time.Duration
+	// MaxAttempts is how many times an event is handled before it is
+	// skipped, so one bad event doesn't stall the watcher forever.
+	MaxAttempts int
+}
+
+// Watcher delivers the changes to a set of collections. The resume token is
+// stored after each handled event under the watcher name, so a restarted
+// watcher continues where it stopped. Delivery is at least once, handlers
+// must be idempotent.
+type Watcher interface {
+	Watch(ctx context.Context, handler func(ctx context.Context, event *ChangeEvent) error) error
+}
+
+type watcher struct {
+	db   *mongo.Database
+	name string
+	opts *WatchOptions
+
+	// the token of the event that keeps failing and its failed attempts
+	failedToken bson.Raw
+	failures    int
+}
+
+func NewWatcher(db *mongo.Database, name string, opts *WatchOptions) Watcher {
+	if opts.RetryDelay == 0 {
+		opts.RetryDelay = 5 * time.Second
+	}
+	if opts.MaxAttempts == 0 {
+		opts.MaxAttempts = 5
+	}
+	return &watcher{db: db, name: name, opts: opts}
+}
+
+// Watch blocks until ctx is done. Failed handlers and stream errors are
+// logged and the stream is opened again from the last stored token. Events
+// that can't be decoded, or whose handler failed MaxAttempts times, are
+// logged and skipped.
+func (w *watcher) Watch(ctx context.Context, handler func(ctx context.Context, event *ChangeEvent) error) error {
+	for {
+		err := w.watch(ctx, handler)
+		if ctx.Err() != nil {
+			return nil
+		}
+		logging.FromContext(ctx).Warn("change stream interrupted, reopening", "stream", w.name, "delay", w.opts.RetryDelay, "err", err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(w.opts.RetryDelay):
+		}
+	}
+}
+
+func (w *watcher) watch(ctx context.Context, handler func(ctx context.Context, event *ChangeEvent) error) error {
+	token, err := w.loadToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	stream, err := w.open(ctx, token)
+	if historyLost(err) {
+		logging.FromContext(ctx).Warn("change stream resume token expired, resetting", "stream", w.name)
+		token = nil
+		stream, err = w.open(ctx, nil)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = stream.Close(context.Background())
+	}()
+
+	// the stream is open before the reset, so nothing written during it is
+	// missed
+	if token == nil && w.opts.Reset != nil {
+		err = w.opts.Reset(ctx)
+		if err != nil {
+			return err
+		}
+		err = w.saveToken(ctx, stream.ResumeToken())
+		if err != nil {
+			return err
+		}
+	}
+
+	for stream.Next(ctx) {
+		var change changeDocument
+		err = stream.Decode(&change)
+		if err != nil {
+			logging.FromContext(ctx).Error("change stream skipped an event it can't decode", "stream", w.name, "err", err)
+		} else {
+			err = handler(ctx, &ChangeEvent{
+				Operation:    change.OperationType,
+				Collection:   change.Namespace.Collection,
+				DocumentID:   change.DocumentKey.ID,
+				FullDocument: change.FullDocument,
+			})
+			if err != nil && !w.giveUp(stream.ResumeToken(), err) {
+				return err
+			}
+		}
+		err = w.saveToken(ctx, stream.ResumeToken())
+		if err != nil {
+			return err
+		}
+	}
+	return stream.Err()
+}
+
+// giveUp counts the failed attempts at the event of token and reports
+// whether it should be skipped.
+func (w *watcher) giveUp(token bson.Raw, cause error) bool {
+	if !bytes.Equal(token, w.failedToken) {
+		w.failedToken = append(bson.Raw(nil), token...)
+		w.failures = 0
+	}
+	w.failures++
+	if w.failures < w.opts.MaxAttempts {
+		return false
+	}
+	logging.Default().Error("change stream skipped an event", "stream", w.name, "attempts", w.failures, "err", cause)
+	w.failedToken = nil
+	w.failures = 0
+	return true
+}
+
+func (w *watcher) open(ctx context.Context, token bson.Raw) (*mongo.ChangeStream, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"ns.coll": bson.M{"$in": w.opts.Collections}}}},
+	}
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if token != nil {
+		opts.SetResumeAfter(token)
+	}
+	return w.db.Watch(ctx, pipeline, opts)
+}
+
+type resumeToken struct {
+	Name      string    `bson:"_id"`
+	Token     bson.Raw  `bson:"token"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+func (w *watcher) loadToken(ctx context.Context) (bson.Raw, error) {
+	var stored resumeToken
+	err := w.db.Collection(resumeTokensCollection).FindOne(ctx, bson.M{"_id": w.name}).Decode(&stored)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stored.Token, nil
+}
+
+func (w *watcher) saveToken(ctx context.Context, token bson.Raw) error {
+	if token == nil {
+		return nil
+	}
+	_, err := w.db.Collection(resumeTokensCollection).UpdateOne(ctx,
+		bson.M{"_id": w.name},
+		bson.M{"$set": bson.M{"token": token, "updated_at": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func historyLost(err error) bool {
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) {
+		return serverErr.HasErrorCode(codeChangeStreamHistoryLost) || serverErr.HasErrorCode(codeChangeStreamFatalError)
+	}
+	return false
+}
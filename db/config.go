@@ -1,63 +1,160 @@
 package db
 
 import (
-	"flag"
-	"fmt"
-	"log"
-	"os"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+	"io/ioutil"
+	"net"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 )
 
-var (
-	dbUser string
-	dbPass string
-	dbHost string
-	dbPort int
-	dbName string
-)
+var ErrInvalidTLSCA = errors.New("no certificate found in tls ca file")
 
-func LoadConfigFromEnv() {
-	dbUser = os.Getenv("MONGODB_USER")
-	dbPass = os.Getenv("MONGODB_PASS")
-	dbHost = os.Getenv("MONGODB_HOST")
-	dbName = os.Getenv("MONGODB_NAME")
-	var err error
-	dbPort, err = strconv.Atoi(os.Getenv("MONGODB_PORT"))
-	if err != nil {
-		log.Panicln(err)
-	}
-}
+// ConnectionOptions describe how to reach MongoDB. URI, when set, replaces
+// User, Pass, Host and Port. The other settings override the URI when set.
+type ConnectionOptions struct {
+	URI        string
+	User       string
+	Pass       string
+	Host       string
+	Port       int
+	Name       string
+	AuthSource string
+	ReplicaSet string
 
-func LoadConfigFromFlags(flagSet *flag.FlagSet) {
-	flag.StringVar(&dbUser, "mongodb_user", "ungame", "mongodb user")
-	flag.StringVar(&dbPass, "mongodb_pass", "secret", "mongodb password")
-	flag.StringVar(&dbHost, "mongodb_host", "localhost", "mongodb host")
-	flag.IntVar(&dbPort, "mongodb_port", 27017, "mongodb port")
-	flag.StringVar(&dbName, "mongodb_name", "workflows", "mongodb database name")
+	TLS         bool
+	TLSCAFile   string
+	TLSCertFile string
+	TLSInsecure bool
+
+	MaxPoolSize            uint64
+	MinPoolSize            uint64
+	MaxConnIdleTime        time.Duration
+	ConnectTimeout         time.Duration
+	ServerSelectionTimeout time.Duration
+	SocketTimeout          time.Duration
 }
 
 type Config interface {
 	URL() string
+	Database() string
+	ClientOptions() (*options.ClientOptions, error)
 }
 
 type config struct {
-	dbUser string
-	dbPass string
-	dbHost string
-	dbPort int
-	dbName string
+	opts ConnectionOptions
 }
 
-func NewConfig() Config {
-	return &config{
-		dbUser: dbUser,
-		dbPass: dbPass,
-		dbHost: dbHost,
-		dbPort: dbPort,
-		dbName: dbName,
-	}
+func NewConfig(opts *ConnectionOptions) Config {
+	return &config{opts: *opts}
 }
 
+// URL returns the configured URI as is, or builds one from the structured
+// fields. A host list for a replica set is used as is, a single host gets
+// the port appended.
 func (cfg *config) URL() string {
-	return fmt.Sprintf("mongodb://%s:%s@%s:%d/%s?w=majority", cfg.dbUser, cfg.dbPass, cfg.dbHost, cfg.dbPort, cfg.dbName)
+	if cfg.opts.URI != "" {
+		return cfg.opts.URI
+	}
+	host := cfg.opts.Host
+	if !strings.Contains(host, ",") && !strings.Contains(host, ":") {
+		host = net.JoinHostPort(host, strconv.Itoa(cfg.opts.Port))
+	}
+	u := url.URL{
+		Scheme:   "mongodb",
+		Host:     host,
+		Path:     "/" + cfg.opts.Name,
+		RawQuery: "w=majority",
+	}
+	if cfg.opts.User != "" {
+		u.User = url.UserPassword(cfg.opts.User, cfg.opts.Pass)
+	}
+	return u.String()
+}
+
+// Database is the database in the URI path, or the configured name.
+func (cfg *config) Database() string {
+	if cfg.opts.URI != "" {
+		cs, err := connstring.Parse(cfg.opts.URI)
+		if err == nil && cs.Database != "" {
+			return cs.Database
+		}
+	}
+	return cfg.opts.Name
+}
+
+// ClientOptions applies the URI first, the structured settings override it
+// when set.
+func (cfg *config) ClientOptions() (*options.ClientOptions, error) {
+	opts := options.Client().ApplyURI(cfg.URL())
+	err := opts.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.opts.AuthSource != "" && opts.Auth != nil {
+		opts.Auth.AuthSource = cfg.opts.AuthSource
+	}
+	if cfg.opts.ReplicaSet != "" {
+		opts.SetReplicaSet(cfg.opts.ReplicaSet)
+	}
+	if cfg.opts.TLS || cfg.opts.TLSCAFile != "" || cfg.opts.TLSCertFile != "" {
+		tlsConfig, err := cfg.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+	if cfg.opts.MaxPoolSize > 0 {
+		opts.SetMaxPoolSize(cfg.opts.MaxPoolSize)
+	}
+	if cfg.opts.MinPoolSize > 0 {
+		opts.SetMinPoolSize(cfg.opts.MinPoolSize)
+	}
+	if cfg.opts.MaxConnIdleTime > 0 {
+		opts.SetMaxConnIdleTime(cfg.opts.MaxConnIdleTime)
+	}
+	if cfg.opts.ConnectTimeout > 0 {
+		opts.SetConnectTimeout(cfg.opts.ConnectTimeout)
+	}
+	if cfg.opts.ServerSelectionTimeout > 0 {
+		opts.SetServerSelectionTimeout(cfg.opts.ServerSelectionTimeout)
+	}
+	if cfg.opts.SocketTimeout > 0 {
+		opts.SetSocketTimeout(cfg.opts.SocketTimeout)
+	}
+	return opts, nil
+}
+
+func (cfg *config) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.opts.TLSInsecure,
+	}
+	if cfg.opts.TLSCAFile != "" {
+		pem, err := ioutil.ReadFile(cfg.opts.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, ErrInvalidTLSCA
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.opts.TLSCertFile != "" {
+		// the driver expects the certificate and the key in the same file
+		cert, err := tls.LoadX509KeyPair(cfg.opts.TLSCertFile, cfg.opts.TLSCertFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
 }
@@ -2,29 +2,34 @@ package db
 
 import (
 	"context"
+	"go-temporal-workflow/logging"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
-	"log"
 )
 
 type Connection interface {
+	Transactor
 	DB() *mongo.Database
 	Ping(ctx context.Context) error
 	Close(ctx context.Context)
 }
 
 type connection struct {
+	Transactor
 	client *mongo.Client
+	name   string
 }
 
-func New(ctx context.Context, cfg Config) Connection {
-	clientOptions := options.Client().ApplyURI(cfg.URL())
+func New(ctx context.Context, cfg Config) (Connection, error) {
+	clientOptions, err := cfg.ClientOptions()
+	if err != nil {
+		return nil, err
+	}
 	client, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
-		log.Panicln(err)
+		return nil, err
 	}
-	return &connection{client: client}
+	return &connection{Transactor: NewTransactor(client, nil), client: client, name: cfg.Database()}, nil
 }
 
 func (c *connection) Ping(ctx context.Context) error {
@@ -34,10 +39,10 @@ func (c *connection) Ping(ctx context.Context) error {
 func (c *connection) Close(ctx context.Context) {
 	err := c.client.Disconnect(ctx)
 	if err != nil {
-		log.Println("error on disconnect mongodb:", err)
+		logging.FromContext(ctx).Error("error on disconnect mongodb", "err", err)
 	}
 }
 
 func (c *connection) DB() *mongo.Database {
-	return c.client.Database(dbName)
+	return c.client.Database(c.name)
 }
\ No newline at end of file
@@ -0,0 +1,186 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-temporal-workflow/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sort"
+	"time"
+)
+
+const migrationsCollection = "schema_migrations"
+
+var ErrNoMigration = errors.New("no migration to revert")
+
+// Migration changes the schema of the database. Versions are applied in
+// ascending order and must never be renumbered once released.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+	Down    func(ctx context.Context, db *mongo.Database) error
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type appliedMigration struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+// Migrator applies and reverts migrations, recording the applied versions
+// in the schema_migrations collection.
+type Migrator interface {
+	Up(ctx context.Context) (int, error)
+	Down(ctx context.Context, steps int) (int, error)
+	Status(ctx context.Context) ([]*MigrationStatus, error)
+}
+
+type migrator struct {
+	db         *mongo.Database
+	migrations []Migration
+}
+
+func NewMigrator(db *mongo.Database, migrations []Migration) Migrator {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	return &migrator{db: db, migrations: sorted}
+}
+
+func (m *migrator) applied(ctx context.Context) (map[int]*appliedMigration, error) {
+	cursor, err := m.db.Collection(migrationsCollection).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var records []*appliedMigration
+	err = cursor.All(ctx, &records)
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int]*appliedMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// Up applies the pending migrations in order and returns how many ran. It
+// stops at the first failure, the migrations before it stay applied.
+func (m *migrator) Up(ctx context.Context) (int, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		logging.FromContext(ctx).Info("applying migration", "version", migration.Version, "name", migration.Name)
+		err = migration.Up(ctx, m.db)
+		if err != nil {
+			return n, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		_, err = m.db.Collection(migrationsCollection).InsertOne(ctx, &appliedMigration{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			AppliedAt: time.Now(),
+		})
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Down reverts the last steps applied migrations, newest first.
+func (m *migrator) Down(ctx context.Context, steps int) (int, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(applied) == 0 {
+		return 0, ErrNoMigration
+	}
+	n := 0
+	for i := len(m.migrations) - 1; i >= 0 && n < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		logging.FromContext(ctx).Info("reverting migration", "version", migration.Version, "name", migration.Name)
+		if migration.Down != nil {
+			err = migration.Down(ctx, m.db)
+			if err != nil {
+				return n, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+			}
+		}
+		_, err = m.db.Collection(migrationsCollection).DeleteOne(ctx, bson.M{"_id": migration.Version})
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (m *migrator) Status(ctx context.Context) ([]*MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status := make([]*MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		s := &MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if record, ok := applied[migration.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = record.AppliedAt
+		}
+		status = append(status, s)
+	}
+	return status, nil
+}
+
+// CreateIndex returns a migration step creating an index named name.
+func CreateIndex(collection, name string, keys bson.D, unique bool) func(ctx context.Context, db *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		opts := options.Index().SetName(name)
+		if unique {
+			opts.SetUnique(true)
+		}
+		_, err := db.Collection(collection).Indexes().CreateOne(ctx, mongo.IndexModel{Keys: keys, Options: opts})
+		return err
+	}
+}
+
+// CreateTTLIndex returns a migration step creating an index named name that
+// removes documents once the time in field has passed.
+func CreateTTLIndex(collection, name, field string) func(ctx context.Context, db *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		opts := options.Index().SetName(name).SetExpireAfterSeconds(0)
+		_, err := db.Collection(collection).Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: field, Value: 1}}, Options: opts})
+		return err
+	}
+}
+
+// DropIndex returns a migration step dropping the index named name.
+func DropIndex(collection, name string) func(ctx context.Context, db *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection(collection).Indexes().DropOne(ctx, name)
+		return err
+	}
+}
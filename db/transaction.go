@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"go-temporal-workflow/logging"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+const (
+	transientTransactionError      = "TransientTransactionError"
+	unknownTransactionCommitResult = "UnknownTransactionCommitResult"
+)
+
+// TransactionOptions bound how often a transaction is retried after a
+// transient error.
+type TransactionOptions struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+func DefaultTransactionOptions() *TransactionOptions {
+	return &TransactionOptions{
+		MaxAttempts:    5,
+		InitialBackoff: 50 * time.Millisecond,
+		MaxBackoff:     time.Second,
+	}
+}
+
+// Transactor runs functions in a multi-document transaction. Store methods
+// called with txCtx take part in the transaction, their writes are committed
+// together when fn returns nil and discarded otherwise.
+//
+// fn may run more than once, so it must read what it writes again on every
+// run. When ctx already carries a session, fn joins the outer transaction.
+type Transactor interface {
+	WithTransaction(ctx context.Context, fn func(txCtx context.Context) error) error
+}
+
+type transactor struct {
+	client *mongo.Client
+	opts   *TransactionOptions
+}
+
+func NewTransactor(client *mongo.Client, opts *TransactionOptions) Transactor {
+	if opts == nil {
+		opts = DefaultTransactionOptions()
+	}
+	return &transactor{client: client, opts: opts}
+}
+
+func (t *transactor) WithTransaction(ctx context.Context, fn func(txCtx context.Context) error) error {
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	backoff := t.opts.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := t.run(ctx, fn)
+		if err == nil || !hasErrorLabel(err, transientTransactionError) || attempt >= t.opts.MaxAttempts {
+			return err
+		}
+		logging.FromContext(ctx).Warn("transient transaction error, retrying", "backoff", backoff, "attempt", attempt, "err", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > t.opts.MaxBackoff {
+			backoff = t.opts.MaxBackoff
+		}
+	}
+}
+
+func (t *transactor) run(ctx context.Context, fn func(txCtx context.Context) error) error {
+	session, err := t.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	return mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
+		err := sc.StartTransaction()
+		if err != nil {
+			return err
+		}
+		err = fn(sc)
+		if err != nil {
+			abortErr := sc.AbortTransaction(context.Background())
+			if abortErr != nil {
+				logging.FromContext(sc).Error("error on abort transaction", "err", abortErr)
+			}
+			return err
+		}
+		return t.commit(sc)
+	})
+}
+
+// commit retries the commit alone while its outcome is unknown, committing
+// twice is safe.
+func (t *transactor) commit(sc mongo.SessionContext) error {
+	for attempt := 1; ; attempt++ {
+		err := sc.CommitTransaction(sc)
+		if err == nil || !hasErrorLabel(err, unknownTransactionCommitResult) || attempt >= t.opts.MaxAttempts {
+			return err
+		}
+		logging.FromContext(sc).Warn("unknown commit result, retrying", "attempt", attempt, "err", err)
+	}
+}
+
+func hasErrorLabel(err error, label string) bool {
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) {
+		return serverErr.HasErrorLabel(label)
+	}
+	return false
+}
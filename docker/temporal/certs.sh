@@ -0,0 +1,24 @@
+#!/bin/sh
+# Generates a self-signed CA, a server certificate for the frontend and a
+# client certificate for mTLS into ./certs.
+set -e
+cd "$(dirname "$0")"
+mkdir -p certs
+cd certs
+
+openssl req -x509 -newkey rsa:4096 -sha256 -days 365 -nodes \
+  -keyout ca.key -out ca.pem -subj "/CN=temporal-dev-ca"
+
+openssl req -newkey rsa:4096 -nodes -keyout server.key -out server.csr \
+  -subj "/CN=temporal"
+printf "subjectAltName=DNS:temporal,DNS:localhost,IP:127.0.0.1\n" > server.ext
+openssl x509 -req -in server.csr -CA ca.pem -CAkey ca.key -CAcreateserial \
+  -days 365 -sha256 -extfile server.ext -out server.pem
+
+openssl req -newkey rsa:4096 -nodes -keyout client.key -out client.csr \
+  -subj "/CN=go-temporal-workflow"
+openssl x509 -req -in client.csr -CA ca.pem -CAkey ca.key -CAcreateserial \
+  -days 365 -sha256 -out client.pem
+
+rm -f server.csr client.csr server.ext
+chmod 644 *.key
@@ -1,6 +1,7 @@
 package forms
 
 import (
+	commonpb "go.temporal.io/api/common/v1"
 	"time"
 )
 
@@ -12,20 +13,45 @@ type SignUpInput struct {
 type SignInInput struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	IP       string `json:"-"`
 }
 
 type SignInOutput struct {
-	Token string `json:"token"`
+	Token          string `json:"token,omitempty"`
+	MFARequired    bool   `json:"mfa_required,omitempty"`
+	ChallengeToken string `json:"challenge_token,omitempty"`
+}
+
+type MFAChallengeInput struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+	IP             string `json:"-"`
+}
+
+type MFAEnrollOutput struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type MFACodeInput struct {
+	UserID string `json:"-"`
+	Code   string `json:"code"`
+}
+
+type MFAActivateOutput struct {
+	RecoveryCodes []string `json:"recovery_codes"`
 }
 
 type UserOutput struct {
-	ID        string    `json:"id"`
-	Email     string    `json:"email"`
-	Password  string    `json:"-"`
-	Balance   float64   `json:"balance"`
-	Role      string    `json:"role"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID         string    `json:"id"`
+	Email      string    `json:"email"`
+	Password   string    `json:"-"`
+	Balance    float64   `json:"balance"`
+	Role       string    `json:"role"`
+	MFAEnabled bool      `json:"mfa_enabled"`
+	Suspended  bool      `json:"suspended"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
 }
 
 type DepositInput struct {
@@ -35,6 +61,9 @@ type DepositInput struct {
 
 type SubscribeInput struct {
 	UserID string `json:"user_id"`
+	// CommandID is the ID of the subscribe message. Retries of the same
+	// message subscribe with the same ID.
+	CommandID string `json:"-"`
 }
 
 type SubscriptionOutput struct {
@@ -51,7 +80,141 @@ type SubscriptionOutput struct {
 	DeletedAt   time.Time `json:"deleted_at"`
 }
 
+type AccountSummaryOutput struct {
+	UserID           string     `json:"user_id"`
+	Balance          float64    `json:"balance"`
+	SubscriptionID   string     `json:"subscription_id,omitempty"`
+	SubscriptionType string     `json:"subscription_type,omitempty"`
+	NextChargeAt     *time.Time `json:"next_charge_at,omitempty"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+type SubscriptionEventOutput struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	Actor      string    `json:"actor"`
+	Amount     float64   `json:"amount,omitempty"`
+	WorkflowID string    `json:"workflow_id,omitempty"`
+	RunID      string    `json:"run_id,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
 type CancelSubscriptionInput struct {
 	UserID string `json:"user_id"`
 	SubID  string `json:"sub_id"`
 }
+
+type CommandOutput struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	Status     string    `json:"status"`
+	WorkflowID string    `json:"workflow_id,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type SubscribeReply struct {
+	WorkflowID string `json:"workflow_id,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type CancelWorkflowInput struct {
+	UserID string `json:"user_id"`
+	SubID  string `json:"sub_id"`
+}
+
+type AdminUsersInput struct {
+	Email    string `query:"email"`
+	Page     int64  `query:"page"`
+	PageSize int64  `query:"page_size"`
+}
+
+type AdminUsersOutput struct {
+	Users    []*UserOutput `json:"users"`
+	Total    int64         `json:"total"`
+	Page     int64         `json:"page"`
+	PageSize int64         `json:"page_size"`
+}
+
+type AdminUserOutput struct {
+	*UserOutput
+	Subscriptions []*SubscriptionOutput `json:"subscriptions"`
+}
+
+type AdminActionInput struct {
+	ActorID string `json:"-"`
+	UserID  string `json:"-"`
+	Reason  string `json:"reason"`
+}
+
+type ChangeRoleInput struct {
+	AdminActionInput
+	Role string `json:"role"`
+}
+
+type AdjustBalanceInput struct {
+	AdminActionInput
+	Amount float64 `json:"amount"`
+}
+
+type DeadLettersInput struct {
+	AdminActionInput
+	Queue string `json:"-"`
+	Limit int    `json:"limit" query:"limit"`
+}
+
+type DeadLetterOutput struct {
+	MessageID      string    `json:"message_id"`
+	Type           string    `json:"type"`
+	Version        int       `json:"version"`
+	CorrelationID  string    `json:"correlation_id"`
+	Data           string    `json:"data"`
+	Attempts       int       `json:"attempts"`
+	LastError      string    `json:"last_error"`
+	OriginalQueue  string    `json:"original_queue"`
+	DeadLetteredAt time.Time `json:"dead_lettered_at"`
+}
+
+type ReplayDeadLettersOutput struct {
+	Queue    string `json:"queue"`
+	Replayed int    `json:"replayed"`
+}
+
+// CodecPayloads is the body of the codec server requests and responses.
+type CodecPayloads struct {
+	Payloads []*commonpb.Payload `json:"payloads"`
+}
+
+type AuditEntryOutput struct {
+	ID        string                 `json:"id"`
+	ActorID   string                 `json:"actor_id"`
+	Action    string                 `json:"action"`
+	TargetID  string                 `json:"target_id"`
+	Reason    string                 `json:"reason,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+type TransactionOutput struct {
+	ID             string    `json:"id"`
+	SubscriptionID string    `json:"subscription_id,omitempty"`
+	Type           string    `json:"type"`
+	Amount         float64   `json:"amount"`
+	Balance        float64   `json:"balance"`
+	Reason         string    `json:"reason,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type DeleteAccountOutput struct {
+	WorkflowID string `json:"workflow_id"`
+	RunID      string `json:"run_id"`
+}
+
+type AccountExport struct {
+	ExportedAt    time.Time             `json:"exported_at"`
+	Profile       *UserOutput           `json:"profile"`
+	Subscriptions []*SubscriptionOutput `json:"subscriptions"`
+	Transactions  []*TransactionOutput  `json:"transactions"`
+}
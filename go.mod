@@ -8,6 +8,8 @@ require (
 	github.com/joho/godotenv v1.4.0
 	github.com/streadway/amqp v1.0.0
 	go.mongodb.org/mongo-driver v1.7.3
+	go.temporal.io/api v1.5.0
 	go.temporal.io/sdk v1.10.0
 	golang.org/x/crypto v0.0.0-20210921155107-089bfa567519
+	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
 )
@@ -0,0 +1,144 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"go-temporal-workflow/logging"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Manager runs the long-lived parts of a process and shuts them down in a
+// fixed order. Shutdown starts on SIGINT or SIGTERM, or when a service run
+// with Go returns. The stop hooks then run one after the other, in the order
+// they were added, sharing a single deadline.
+type Manager interface {
+	Go(name string, run func() error)
+	OnStop(name string, stop func(ctx context.Context) error)
+	Wait() error
+}
+
+type hook struct {
+	name string
+	stop func(ctx context.Context) error
+}
+
+type manager struct {
+	timeout time.Duration
+
+	mu       sync.Mutex
+	hooks    []hook
+	err      error
+	services sync.WaitGroup
+	shutdown chan struct{}
+	once     sync.Once
+}
+
+func NewManager(timeout time.Duration) Manager {
+	return &manager{
+		timeout:  timeout,
+		shutdown: make(chan struct{}),
+	}
+}
+
+// Go runs a blocking service such as an HTTP server or a consumer. When it
+// returns, with or without an error, the process shuts down.
+func (m *manager) Go(name string, run func() error) {
+	m.services.Add(1)
+	go func() {
+		defer m.services.Done()
+		err := run()
+		if err != nil {
+			logging.Default().Error("service stopped", "service", name, "err", err)
+			m.setErr(fmt.Errorf("%s: %w", name, err))
+		}
+		m.stop()
+	}()
+}
+
+func (m *manager) OnStop(name string, stop func(ctx context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, hook{name: name, stop: stop})
+}
+
+// Wait blocks until shutdown starts, runs the stop hooks and waits for the
+// services to return. It returns the first error of a service or hook.
+func (m *manager) Wait() error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case sig := <-signals:
+		logging.Default().Info("shutting down", "signal", sig)
+	case <-m.shutdown:
+		logging.Default().Info("service stopped, shutting down")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	m.mu.Lock()
+	hooks := m.hooks
+	m.mu.Unlock()
+
+	for _, h := range hooks {
+		err := h.stop(ctx)
+		if err != nil {
+			logging.Default().Error("error on stop", "service", h.name, "err", err)
+			m.setErr(fmt.Errorf("stop %s: %w", h.name, err))
+			continue
+		}
+		logging.Default().Info("stopped", "service", h.name)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.services.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		m.setErr(fmt.Errorf("services still running: %w", ctx.Err()))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err
+}
+
+func (m *manager) stop() {
+	m.once.Do(func() {
+		close(m.shutdown)
+	})
+}
+
+func (m *manager) setErr(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err == nil {
+		m.err = err
+	}
+}
+
+// Func adapts a stop function that can't be interrupted. It runs in the
+// background and is abandoned when ctx is done.
+func Func(stop func() error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		done := make(chan error, 1)
+		go func() {
+			done <- stop()
+		}()
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
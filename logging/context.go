@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// RequestIDKey is the key of the request ID in the context and of the field
+// in log entries. It is a string so Fiber locals stored under it are seen by
+// RequestID through the fasthttp request context.
+const RequestIDKey = "request_id"
+
+type requestIDKey struct{}
+
+func NewRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID of ctx, empty when there is none.
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+		return id
+	}
+	id, _ := ctx.Value(RequestIDKey).(string)
+	return id
+}
+
+// FromContext returns the default logger with the request ID of ctx.
+func FromContext(ctx context.Context) Logger {
+	id := RequestID(ctx)
+	if id == "" {
+		return Default()
+	}
+	return Default().With(RequestIDKey, id)
+}
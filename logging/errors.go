@@ -0,0 +1,5 @@
+package logging
+
+import "errors"
+
+var ErrUnknownLevel = errors.New("unknown log level")
@@ -0,0 +1,181 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel reads debug, info, warn or error.
+func ParseLevel(s string) (Level, error) {
+	for level, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return level, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("%w: %q", ErrUnknownLevel, s)
+}
+
+// Logger writes one JSON object per entry with the time, the level, the
+// message and the key value pairs. Its methods match the Temporal SDK
+// logger, so the SDK logs can go through it, see NewTemporalLogger.
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+	// With returns a logger adding keyvals to every entry.
+	With(keyvals ...interface{}) Logger
+}
+
+type output struct {
+	sync.Mutex
+	w io.Writer
+}
+
+type logger struct {
+	out     *output
+	level   Level
+	keyvals []interface{}
+}
+
+// New writes the entries of level and above to w.
+func New(w io.Writer, level Level) Logger {
+	return &logger{out: &output{w: w}, level: level}
+}
+
+func (l *logger) Debug(msg string, keyvals ...interface{}) {
+	l.log(LevelDebug, msg, keyvals)
+}
+
+func (l *logger) Info(msg string, keyvals ...interface{}) {
+	l.log(LevelInfo, msg, keyvals)
+}
+
+func (l *logger) Warn(msg string, keyvals ...interface{}) {
+	l.log(LevelWarn, msg, keyvals)
+}
+
+func (l *logger) Error(msg string, keyvals ...interface{}) {
+	l.log(LevelError, msg, keyvals)
+}
+
+func (l *logger) With(keyvals ...interface{}) Logger {
+	if len(keyvals) == 0 {
+		return l
+	}
+	all := make([]interface{}, 0, len(l.keyvals)+len(keyvals))
+	all = append(append(all, l.keyvals...), keyvals...)
+	return &logger{out: l.out, level: l.level, keyvals: all}
+}
+
+func (l *logger) log(level Level, msg string, keyvals []interface{}) {
+	if level < l.level {
+		return
+	}
+	var buf bytes.Buffer
+	buf.WriteString(`{"time":`)
+	writeValue(&buf, time.Now().UTC().Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	writeValue(&buf, level.String())
+	buf.WriteString(`,"msg":`)
+	writeValue(&buf, msg)
+	writeKeyvals(&buf, l.keyvals)
+	writeKeyvals(&buf, keyvals)
+	buf.WriteString("}\n")
+
+	l.out.Lock()
+	defer l.out.Unlock()
+	_, _ = l.out.w.Write(buf.Bytes())
+}
+
+func writeKeyvals(buf *bytes.Buffer, keyvals []interface{}) {
+	for i := 0; i < len(keyvals); i += 2 {
+		buf.WriteByte(',')
+		writeValue(buf, fmt.Sprint(keyvals[i]))
+		buf.WriteByte(':')
+		if i+1 < len(keyvals) {
+			writeValue(buf, keyvals[i+1])
+		} else {
+			// odd keyvals keep the dangling key visible
+			buf.WriteString("null")
+		}
+	}
+}
+
+func writeValue(buf *bytes.Buffer, v interface{}) {
+	switch x := v.(type) {
+	case error:
+		v = x.Error()
+	case time.Duration:
+		v = x.String()
+	case fmt.Stringer:
+		v = x.String()
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(data)
+}
+
+var (
+	stdMu sync.RWMutex
+	std   = New(os.Stderr, LevelInfo)
+)
+
+// Default is the process wide logger, writing info and above to stderr
+// until SetDefault replaces it.
+func Default() Logger {
+	stdMu.RLock()
+	defer stdMu.RUnlock()
+	return std
+}
+
+func SetDefault(l Logger) {
+	stdMu.Lock()
+	defer stdMu.Unlock()
+	std = l
+}
+
+// RedirectStdLog sends the output of the standard log package to l, one
+// info entry per line, so code still using log.Printf writes JSON too.
+func RedirectStdLog(l Logger) {
+	log.SetFlags(0)
+	log.SetOutput(stdWriter{l: l})
+}
+
+type stdWriter struct {
+	l Logger
+}
+
+func (w stdWriter) Write(p []byte) (int, error) {
+	w.l.Info(strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
@@ -0,0 +1,115 @@
+package logging
+
+import (
+	"context"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/log"
+	"go.temporal.io/sdk/workflow"
+)
+
+// temporalLogger adapts a Logger to the SDK logger. The SDK logs at its own
+// level, usually above the one of the services as it is chatty.
+type temporalLogger struct {
+	l     Logger
+	level Level
+}
+
+func NewTemporalLogger(l Logger, level Level) log.Logger {
+	return &temporalLogger{l: l.With("component", "temporal"), level: level}
+}
+
+func (t *temporalLogger) Debug(msg string, keyvals ...interface{}) {
+	if t.level <= LevelDebug {
+		t.l.Debug(msg, keyvals...)
+	}
+}
+
+func (t *temporalLogger) Info(msg string, keyvals ...interface{}) {
+	if t.level <= LevelInfo {
+		t.l.Info(msg, keyvals...)
+	}
+}
+
+func (t *temporalLogger) Warn(msg string, keyvals ...interface{}) {
+	if t.level <= LevelWarn {
+		t.l.Warn(msg, keyvals...)
+	}
+}
+
+func (t *temporalLogger) Error(msg string, keyvals ...interface{}) {
+	t.l.Error(msg, keyvals...)
+}
+
+func (t *temporalLogger) With(keyvals ...interface{}) log.Logger {
+	return &temporalLogger{l: t.l.With(keyvals...), level: t.level}
+}
+
+// WorkflowLogger is workflow.GetLogger with the request ID that started the
+// workflow.
+func WorkflowLogger(ctx workflow.Context) log.Logger {
+	logger := workflow.GetLogger(ctx)
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok && id != "" {
+		return log.With(logger, RequestIDKey, id)
+	}
+	return logger
+}
+
+const requestIDHeader = "request-id"
+
+// contextPropagator carries the request ID in the Temporal headers, from the
+// client starting a workflow to the workflow and from it to its activities
+// and child workflows.
+type contextPropagator struct {
+	converter converter.DataConverter
+}
+
+func NewContextPropagator() workflow.ContextPropagator {
+	return &contextPropagator{converter: converter.GetDefaultDataConverter()}
+}
+
+func (p *contextPropagator) Inject(ctx context.Context, w workflow.HeaderWriter) error {
+	return p.inject(RequestID(ctx), w)
+}
+
+func (p *contextPropagator) InjectFromWorkflow(ctx workflow.Context, w workflow.HeaderWriter) error {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return p.inject(id, w)
+}
+
+func (p *contextPropagator) inject(id string, w workflow.HeaderWriter) error {
+	if id == "" {
+		return nil
+	}
+	payload, err := p.converter.ToPayload(id)
+	if err != nil {
+		return err
+	}
+	w.Set(requestIDHeader, payload)
+	return nil
+}
+
+func (p *contextPropagator) Extract(ctx context.Context, r workflow.HeaderReader) (context.Context, error) {
+	id, err := p.extract(r)
+	if err != nil {
+		return ctx, err
+	}
+	return WithRequestID(ctx, id), nil
+}
+
+func (p *contextPropagator) ExtractToWorkflow(ctx workflow.Context, r workflow.HeaderReader) (workflow.Context, error) {
+	id, err := p.extract(r)
+	if err != nil || id == "" {
+		return ctx, err
+	}
+	return workflow.WithValue(ctx, requestIDKey{}, id), nil
+}
+
+func (p *contextPropagator) extract(r workflow.HeaderReader) (string, error) {
+	payload, ok := r.Get(requestIDHeader)
+	if !ok {
+		return "", nil
+	}
+	var id string
+	err := p.converter.FromPayload(payload, &id)
+	return id, err
+}
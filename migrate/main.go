@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"go-temporal-workflow/config"
+	"go-temporal-workflow/db"
+	"go-temporal-workflow/store"
+	"go-temporal-workflow/utils"
+	"log"
+	"os"
+	"time"
+)
+
+const usage = "usage: migrate [flags] up | down [-steps n] | status"
+
+func main() {
+	timeout := flag.Duration("timeout", time.Minute, "set how long the migrations may run")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	// only the mongodb settings are needed here
+	cfg, err := config.LoadUnvalidated(flag.CommandLine, os.Args[1:], utils.GetEnvFilePath())
+	if err != nil {
+		log.Fatalln(err)
+	}
+	err = cfg.MongoDB.Validate()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	dbConn, err := db.New(ctx, db.NewConfig(cfg.MongoDB.ConnectionOptions()))
+	if err != nil {
+		log.Panicln(err)
+	}
+	defer dbConn.Close(context.Background())
+
+	err = dbConn.Ping(ctx)
+	if err != nil {
+		log.Panicln(err)
+	}
+
+	migrator := db.NewMigrator(dbConn.DB(), store.Migrations)
+
+	switch flag.Arg(0) {
+	case "up":
+		n, err := migrator.Up(ctx)
+		if err != nil {
+			log.Fatalf("migrate up: applied=%d err=%s\n", n, err)
+		}
+		log.Printf("migrate up: applied=%d\n", n)
+	case "down":
+		downFlags := flag.NewFlagSet("down", flag.ExitOnError)
+		steps := downFlags.Int("steps", 1, "set how many migrations to revert")
+		_ = downFlags.Parse(flag.Args()[1:])
+		n, err := migrator.Down(ctx, *steps)
+		if err != nil {
+			log.Fatalf("migrate down: reverted=%d err=%s\n", n, err)
+		}
+		log.Printf("migrate down: reverted=%d\n", n)
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		for _, s := range status {
+			if s.Applied {
+				fmt.Printf("%4d  %-40s  applied %s\n", s.Version, s.Name, s.AppliedAt.Format(time.RFC3339))
+			} else {
+				fmt.Printf("%4d  %-40s  pending\n", s.Version, s.Name)
+			}
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// AccountSummary is a read model derived from the users and subscriptions
+// collections. It is never written by the services, only by the projection.
+type AccountSummary struct {
+	UserID           primitive.ObjectID `bson:"_id"`
+	Balance          float64            `bson:"balance"`
+	SubscriptionID   primitive.ObjectID `bson:"subscription_id,omitempty"`
+	SubscriptionType string             `bson:"subscription_type,omitempty"`
+	NextChargeAt     time.Time          `bson:"next_charge_at,omitempty"`
+	UpdatedAt        time.Time          `bson:"updated_at"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const (
+	AuditUnlockUser    = "user.unlock"
+	AuditChangeRole    = "user.change_role"
+	AuditSuspendUser   = "user.suspend"
+	AuditReactivate    = "user.reactivate"
+	AuditAdjustBalance = "user.adjust_balance"
+	AuditDeleteUser    = "user.delete"
+	AuditReplayDead    = "dead_letters.replay"
+)
+
+type AuditEntry struct {
+	ID        primitive.ObjectID     `bson:"_id"`
+	ActorID   primitive.ObjectID     `bson:"actor_id"`
+	Action    string                 `bson:"action"`
+	TargetID  primitive.ObjectID     `bson:"target_id"`
+	Reason    string                 `bson:"reason,omitempty"`
+	Data      map[string]interface{} `bson:"data,omitempty"`
+	CreatedAt time.Time              `bson:"created_at"`
+}
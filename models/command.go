@@ -0,0 +1,25 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const (
+	CommandPending   = "pending"
+	CommandSucceeded = "succeeded"
+	CommandFailed    = "failed"
+)
+
+// Command tracks an asynchronous operation requested through the API. Its
+// ID is the ID of the message that carries it.
+type Command struct {
+	ID         string             `bson:"_id"`
+	Type       string             `bson:"type"`
+	UserID     primitive.ObjectID `bson:"user_id"`
+	Status     string             `bson:"status"`
+	WorkflowID string             `bson:"workflow_id,omitempty"`
+	Error      string             `bson:"error,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at"`
+	UpdatedAt  time.Time          `bson:"updated_at"`
+}
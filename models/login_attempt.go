@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// LoginAttempt counts the sign in attempts of a key that weren't successful,
+// including the ones still running. It is removed at ExpiresAt.
+type LoginAttempt struct {
+	Key           string    `bson:"_id"`
+	Failures      int       `bson:"failures"`
+	LastFailureAt time.Time `bson:"last_failure_at"`
+	LockedUntil   time.Time `bson:"locked_until"`
+	ExpiresAt     time.Time `bson:"expires_at"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	// OutboxFailed entries ran out of attempts, the relay skips them.
+	OutboxFailed = "failed"
+)
+
+// OutboxEntry is a message stored with the domain write that produced it,
+// waiting to be published by the relay. Topic and Key are stored under the
+// names of the entries written before the bus.
+type OutboxEntry struct {
+	ID            primitive.ObjectID `bson:"_id"`
+	MessageID     string             `bson:"message_id"`
+	Type          string             `bson:"type"`
+	Version       int                `bson:"version"`
+	Timestamp     time.Time          `bson:"timestamp"`
+	CorrelationID string             `bson:"correlation_id,omitempty"`
+	CausationID   string             `bson:"causation_id,omitempty"`
+	RequestID     string             `bson:"request_id,omitempty"`
+	ReplyTo       string             `bson:"reply_to,omitempty"`
+	Data          []byte             `bson:"data"`
+	Topic         string             `bson:"exchange"`
+	Key           string             `bson:"routing_key"`
+	Status        string             `bson:"status"`
+	Attempts      int                `bson:"attempts"`
+	LastError     string             `bson:"last_error,omitempty"`
+	LockedUntil   time.Time          `bson:"locked_until"`
+	CreatedAt     time.Time          `bson:"created_at"`
+	SentAt        time.Time          `bson:"sent_at,omitempty"`
+}
+
+// InboxEntry records a message already handled by a consumer.
+type InboxEntry struct {
+	ID        string    `bson:"_id"`
+	Consumer  string    `bson:"consumer"`
+	MessageID string    `bson:"message_id"`
+	HandledAt time.Time `bson:"handled_at"`
+}
@@ -15,4 +15,7 @@ type Subscription struct {
 	ActivatedAt time.Time          `bson:"activated_at"`
 	ExpiresAt   time.Time          `bson:"expires_at"`
 	CanceledAt  time.Time          `bson:"canceled_at"`
+	Deleted     bool               `bson:"deleted"`
+	DeletedAt   time.Time          `bson:"deleted_at"`
+	Version     int64              `bson:"version"`
 }
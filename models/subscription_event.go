@@ -0,0 +1,46 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const (
+	SubscriptionCreated       = "created"
+	SubscriptionCharged       = "charged"
+	SubscriptionRenewalFailed = "renewal_failed"
+	SubscriptionCanceled      = "canceled"
+	SubscriptionExpired       = "expired"
+	SubscriptionDeleted       = "deleted"
+)
+
+// ActorSystem is the actor of the events caused by the subscription workflow
+// rather than by a user.
+const ActorSystem = "system"
+
+// SubscriptionEvent is an entry of the append-only history of a
+// subscription. Actor is the hex ID of the user who caused it or ActorSystem.
+type SubscriptionEvent struct {
+	ID             primitive.ObjectID `bson:"_id"`
+	SubscriptionID primitive.ObjectID `bson:"subscription_id"`
+	UserID         primitive.ObjectID `bson:"user_id"`
+	Type           string             `bson:"type"`
+	Actor          string             `bson:"actor"`
+	Amount         float64            `bson:"amount,omitempty"`
+	WorkflowID     string             `bson:"workflow_id,omitempty"`
+	RunID          string             `bson:"run_id,omitempty"`
+	Reason         string             `bson:"reason,omitempty"`
+	CreatedAt      time.Time          `bson:"created_at"`
+}
+
+func NewSubscriptionEvent(subscription *Subscription, typ, actor string) *SubscriptionEvent {
+	return &SubscriptionEvent{
+		ID:             primitive.NewObjectID(),
+		SubscriptionID: subscription.ID,
+		UserID:         subscription.UserID,
+		Type:           typ,
+		Actor:          actor,
+		WorkflowID:     subscription.ID.Hex(),
+		CreatedAt:      time.Now(),
+	}
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const (
+	TransactionDeposit    = "deposit"
+	TransactionCharge     = "charge"
+	TransactionAdjustment = "adjustment"
+	TransactionRefund     = "refund"
+	TransactionForfeit    = "forfeit"
+)
+
+type Transaction struct {
+	ID             primitive.ObjectID `bson:"_id"`
+	UserID         primitive.ObjectID `bson:"user_id"`
+	SubscriptionID primitive.ObjectID `bson:"subscription_id,omitempty"`
+	Type           string             `bson:"type"`
+	Amount         float64            `bson:"amount"`
+	Balance        float64            `bson:"balance"`
+	Reason         string             `bson:"reason,omitempty"`
+	CreatedAt      time.Time          `bson:"created_at"`
+}
+
+func NewTransaction(user *User, typ string, amount float64) *Transaction {
+	return &Transaction{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		Type:      typ,
+		Amount:    amount,
+		Balance:   user.Balance,
+		CreatedAt: time.Now(),
+	}
+}
@@ -5,12 +5,28 @@ import (
 	"time"
 )
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
-	ID           primitive.ObjectID `bson:"_id"`
-	Email        string             `bson:"email"`
-	Password     string             `bson:"password"`
-	Balance      float64            `bson:"balance"`
-	Role         string             `bson:"role"`
-	CreatedAt    time.Time          `bson:"created_at"`
-	UpdatedAt    time.Time          `bson:"updated_at"`
+	ID            primitive.ObjectID `bson:"_id"`
+	Email         string             `bson:"email"`
+	Password      string             `bson:"password"`
+	Balance       float64            `bson:"balance"`
+	Role          string             `bson:"role"`
+	MFAEnabled    bool               `bson:"mfa_enabled"`
+	MFASecret     string             `bson:"mfa_secret"`
+	MFALastStep   int64              `bson:"mfa_last_step"`
+	RecoveryCodes []string           `bson:"recovery_codes"`
+	Suspended     bool               `bson:"suspended"`
+	SuspendedAt   time.Time          `bson:"suspended_at"`
+	Deleting      bool               `bson:"deleting"`
+	Deleted       bool               `bson:"deleted"`
+	DeletedAt     time.Time          `bson:"deleted_at"`
+	RevokedAt     time.Time          `bson:"revoked_at"`
+	CreatedAt     time.Time          `bson:"created_at"`
+	UpdatedAt     time.Time          `bson:"updated_at"`
+	Version       int64              `bson:"version"`
 }
@@ -0,0 +1,42 @@
+package outbox
+
+import (
+	"context"
+	"go-temporal-workflow/bus"
+	"go-temporal-workflow/logging"
+	"go-temporal-workflow/store"
+)
+
+// Dedupe wraps a handler so each message ID is handled once per consumer.
+// The message is recorded after the handler succeeds, so a redelivery that
+// races a slow handler can still run twice; handlers stay idempotent.
+func Dedupe(inbox store.InboxStore, consumer string, fn func(msg *bus.Message) error) func(msg *bus.Message) error {
+	return DedupeReply(inbox, consumer, fn, nil)
+}
+
+// DedupeReply is Dedupe for requests: a duplicate is answered by reply
+// instead of being skipped silently, its requester may still be waiting.
+func DedupeReply(inbox store.InboxStore, consumer string, fn, reply func(msg *bus.Message) error) func(msg *bus.Message) error {
+	return func(msg *bus.Message) error {
+		if msg.ID == "" {
+			return fn(msg)
+		}
+		ctx := logging.WithRequestID(context.Background(), msg.RequestID)
+		seen, err := inbox.Seen(ctx, consumer, msg.ID)
+		if err != nil {
+			return err
+		}
+		if seen {
+			logging.FromContext(ctx).Info("duplicate message skipped", "consumer", consumer, "message_id", msg.ID)
+			if reply != nil && msg.ReplyTo != "" {
+				return reply(msg)
+			}
+			return nil
+		}
+		err = fn(msg)
+		if err != nil {
+			return err
+		}
+		return inbox.Record(ctx, consumer, msg.ID)
+	}
+}
@@ -0,0 +1,74 @@
+package outbox
+
+import (
+	"context"
+	"go-temporal-workflow/bus"
+	"go-temporal-workflow/db"
+	"go-temporal-workflow/models"
+	"go-temporal-workflow/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Outbox stores outgoing messages in Mongo instead of publishing them. A
+// message enqueued inside Transaction is stored only if the domain writes
+// made with the same context commit, and the Relay publishes it afterwards.
+//
+// Send enqueues outside of a transaction, for code without domain writes.
+type Outbox interface {
+	Send(topic, key string, msg *bus.Message) error
+	Enqueue(ctx context.Context, topic, key string, msg *bus.Message) error
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type outbox struct {
+	store      store.OutboxStore
+	transactor db.Transactor
+}
+
+func New(outboxStore store.OutboxStore, transactor db.Transactor) Outbox {
+	return &outbox{store: outboxStore, transactor: transactor}
+}
+
+func (o *outbox) Send(topic, key string, msg *bus.Message) error {
+	return o.Enqueue(context.Background(), topic, key, msg)
+}
+
+func (o *outbox) Enqueue(ctx context.Context, topic, key string, msg *bus.Message) error {
+	return o.store.Create(ctx, &models.OutboxEntry{
+		ID:            primitive.NewObjectID(),
+		MessageID:     msg.ID,
+		Type:          msg.Type,
+		Version:       msg.Version,
+		Timestamp:     msg.Timestamp,
+		CorrelationID: msg.CorrelationID,
+		CausationID:   msg.CausationID,
+		RequestID:     msg.RequestID,
+		ReplyTo:       msg.ReplyTo,
+		Data:          msg.Data,
+		Topic:         topic,
+		Key:           key,
+		Status:        models.OutboxPending,
+		CreatedAt:     time.Now(),
+	})
+}
+
+// Transaction runs fn in a Mongo transaction. Stores called with the context
+// passed to fn take part in it.
+func (o *outbox) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return o.transactor.WithTransaction(ctx, fn)
+}
+
+func message(entry *models.OutboxEntry) *bus.Message {
+	return &bus.Message{
+		ID:            entry.MessageID,
+		Type:          entry.Type,
+		Version:       entry.Version,
+		Timestamp:     entry.Timestamp,
+		CorrelationID: entry.CorrelationID,
+		CausationID:   entry.CausationID,
+		RequestID:     entry.RequestID,
+		ReplyTo:       entry.ReplyTo,
+		Data:          entry.Data,
+	}
+}
@@ -0,0 +1,91 @@
+package outbox
+
+import (
+	"context"
+	"go-temporal-workflow/bus"
+	"go-temporal-workflow/logging"
+	"go-temporal-workflow/store"
+	"time"
+)
+
+type RelayOptions struct {
+	// Interval is how long the relay sleeps when the outbox is empty.
+	Interval time.Duration
+	// Lease is how long a claimed entry stays locked. A failed entry is
+	// retried after its lease expires.
+	Lease time.Duration
+	// MaxAttempts is how many times an entry is published before it is
+	// marked failed and left for an operator.
+	MaxAttempts int
+}
+
+func DefaultRelayOptions() *RelayOptions {
+	return &RelayOptions{
+		Interval:    time.Second,
+		Lease:       time.Second * 30,
+		MaxAttempts: 20,
+	}
+}
+
+// Relay publishes the pending outbox entries, oldest first. An entry is
+// marked sent only after the bus accepted it, so a crash in between
+// publishes it again: delivery is at least once and consumers dedupe by
+// message ID. A failed entry waits for its lease while the next ones are
+// published, so entries are not published in order once one fails.
+type Relay interface {
+	Run(ctx context.Context) error
+}
+
+type relay struct {
+	store     store.OutboxStore
+	publisher bus.Publisher
+	opts      *RelayOptions
+}
+
+func NewRelay(outboxStore store.OutboxStore, publisher bus.Publisher, opts *RelayOptions) Relay {
+	if opts == nil {
+		opts = DefaultRelayOptions()
+	}
+	return &relay{store: outboxStore, publisher: publisher, opts: opts}
+}
+
+// Run publishes entries until ctx is done.
+func (r *relay) Run(ctx context.Context) error {
+	for {
+		published, err := r.relayOne(ctx)
+		if err != nil && ctx.Err() == nil {
+			logging.FromContext(ctx).Error("error on relay outbox", "err", err)
+		}
+		if published && err == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(r.opts.Interval):
+		}
+	}
+}
+
+func (r *relay) relayOne(ctx context.Context) (bool, error) {
+	entry, err := r.store.Claim(ctx, r.opts.Lease)
+	if err != nil || entry == nil {
+		return false, err
+	}
+
+	err = r.publisher.Publish(ctx, entry.Topic, entry.Key, message(entry))
+	if err != nil {
+		var markErr error
+		if entry.Attempts+1 >= r.opts.MaxAttempts {
+			logging.FromContext(ctx).Error("outbox entry failed", "message_id", entry.MessageID, "attempts", entry.Attempts+1, "err", err)
+			markErr = r.store.MarkFailed(ctx, entry.ID, err)
+		} else {
+			markErr = r.store.MarkRetry(ctx, entry.ID, err)
+		}
+		if markErr != nil {
+			logging.FromContext(ctx).Error("error on mark outbox entry", "message_id", entry.MessageID, "err", markErr)
+		}
+		return true, err
+	}
+	return true, r.store.MarkSent(ctx, entry.ID)
+}
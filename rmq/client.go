@@ -1,11 +1,14 @@
 package rmq
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
+	"errors"
 	"github.com/streadway/amqp"
-	"log"
+	"go-temporal-workflow/bus"
+	"go-temporal-workflow/logging"
 	"go-temporal-workflow/utils"
+	"sync"
+	"time"
 )
 
 type Client interface {
@@ -13,37 +16,88 @@ type Client interface {
 	QueueDeclare(opts *QueueOptions) error
 	AsConsumer() Consumer
 	AsPublisher() Publisher
+	AsDeadLetters() DeadLetters
 	Close()
 }
 
 type Consumer interface {
-	HandleFunc(messageType interface{}, handler func(data []byte) error)
+	HandleFunc(name string, version int, handler func(msg *Message) error)
+	Upcast(name string, from int, upcaster Upcaster)
 	Listen(opts *ConsumerOptions) error
+	Stop(ctx context.Context) error
+}
+
+type DeadLetters interface {
+	Peek(queue string, limit int) ([]*DeadLetter, error)
+	Replay(queue string, limit int) (int, error)
 }
 
 type Publisher interface {
 	Send(opts *PublisherOptions) error
+	Request(opts *PublisherOptions, timeout time.Duration) (*Message, error)
+	Await(msg *Message, send func(msg *Message) error, timeout time.Duration) (*Message, error)
+	Reply(request *Message, v interface{}) error
 }
 
+// client keeps a supervised connection. When the connection or channel is
+// closed by the broker it reconnects with backoff, declares the recorded
+// exchanges and queues again and lets Listen resume consuming.
 type client struct {
-	conn     *amqp.Connection
-	channel  *amqp.Channel
-	handlers map[string]func(data []byte) error
+	cfg  Config
+	opts *ClientOptions
+
+	mu        sync.RWMutex
+	conn      *amqp.Connection
+	publisher *publishChannel
+	consumer  *amqp.Channel
+	ready     chan struct{}
+	connected bool
+	closed    bool
+	done      chan struct{}
+	exchanges []*ExchangeOptions
+	queues    []*QueueOptions
+	pending   []*outgoing
+	replies   *replies
+
+	handlers  *bus.Registry
+	consumers map[string]*amqp.Channel
+	listeners sync.WaitGroup
+	stopping  chan struct{}
+	stopOnce  sync.Once
 }
 
-func NewClient(cfg Config) Client {
-	var c client
-	var err error
-	c.conn, err = amqp.Dial(cfg.URL())
-	if err != nil {
-		log.Panicln(err)
+func NewClient(cfg Config, opts *ClientOptions) (Client, error) {
+	if opts == nil {
+		opts = DefaultClientOptions()
 	}
-	c.channel, err = c.conn.Channel()
-	if err != nil {
-		log.Panicln(err)
+	c := &client{
+		cfg:       cfg,
+		opts:      opts,
+		ready:     make(chan struct{}),
+		done:      make(chan struct{}),
+		replies:   newReplies(),
+		handlers:  bus.NewRegistry(),
+		consumers: make(map[string]*amqp.Channel),
+		stopping:  make(chan struct{}),
+	}
+
+	backoff := c.opts.InitialBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = c.connect()
+		if err == nil {
+			break
+		}
+		if attempt >= c.opts.DialAttempts {
+			return nil, err
+		}
+		logging.Default().Warn("rabbitmq dial failed, retrying", "backoff", backoff, "attempt", attempt, "err", err)
+		time.Sleep(backoff)
+		backoff = c.nextBackoff(backoff)
 	}
-	c.handlers = make(map[string]func(data []byte) error)
-	return &c
+
+	go c.supervise()
+	return c, nil
 }
 
 func (c *client) AsConsumer() Consumer {
@@ -54,8 +108,170 @@ func (c *client) AsPublisher() Publisher {
 	return c
 }
 
+func (c *client) AsDeadLetters() DeadLetters {
+	return c
+}
+
+// publishChannel is the channel messages are published on, with the
+// confirms tracked for it in confirm mode. Direct reply-to replies are
+// consumed on it too, since they arrive on the channel of the request.
+type publishChannel struct {
+	channel  *amqp.Channel
+	confirms *confirms
+}
+
+// connect opens a connection with one channel for publishing and one for
+// consuming, so acks of deliveries never share a channel with publishes
+// waiting for their confirms.
+func (c *client) connect() error {
+	conn, err := amqp.Dial(c.cfg.URL())
+	if err != nil {
+		return err
+	}
+	publisher := &publishChannel{}
+	publisher.channel, err = conn.Channel()
+	if err != nil {
+		utils.HandleClose(conn)
+		return err
+	}
+	if c.opts.Confirm {
+		publisher.confirms, err = watchConfirms(publisher.channel)
+		if err != nil {
+			utils.HandleClose(conn)
+			return err
+		}
+	}
+	err = c.replies.consume(publisher.channel)
+	if err != nil {
+		utils.HandleClose(conn)
+		return err
+	}
+	consumer, err := conn.Channel()
+	if err != nil {
+		utils.HandleClose(conn)
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, opts := range c.exchanges {
+		err = exchangeDeclare(publisher.channel, opts)
+		if err != nil {
+			utils.HandleClose(conn)
+			return err
+		}
+	}
+	for _, opts := range c.queues {
+		err = queueDeclare(publisher.channel, opts)
+		if err != nil {
+			utils.HandleClose(conn)
+			return err
+		}
+	}
+
+	c.conn = conn
+	c.publisher = publisher
+	c.consumer = consumer
+	c.connected = true
+	close(c.ready)
+	c.flush()
+	return nil
+}
+
+func (c *client) supervise() {
+	for {
+		c.mu.RLock()
+		connClosed := c.conn.NotifyClose(make(chan *amqp.Error, 1))
+		publisherClosed := c.publisher.channel.NotifyClose(make(chan *amqp.Error, 1))
+		consumerClosed := c.consumer.NotifyClose(make(chan *amqp.Error, 1))
+		c.mu.RUnlock()
+
+		select {
+		case <-c.done:
+			return
+		case err := <-connClosed:
+			logging.Default().Warn("rabbitmq connection closed", "err", err)
+		case err := <-publisherClosed:
+			logging.Default().Warn("rabbitmq channel closed", "channel", "publish", "err", err)
+		case err := <-consumerClosed:
+			logging.Default().Warn("rabbitmq channel closed", "channel", "consume", "err", err)
+		}
+
+		c.mu.Lock()
+		c.connected = false
+		c.ready = make(chan struct{})
+		utils.HandleClose(c.conn)
+		c.mu.Unlock()
+
+		backoff := c.opts.InitialBackoff
+		for {
+			select {
+			case <-c.done:
+				return
+			case <-time.After(backoff):
+			}
+			err := c.connect()
+			if err == nil {
+				logging.Default().Info("rabbitmq reconnected")
+				break
+			}
+			logging.Default().Warn("rabbitmq reconnect failed, retrying", "backoff", backoff, "err", err)
+			backoff = c.nextBackoff(backoff)
+		}
+	}
+}
+
+func (c *client) nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > c.opts.MaxBackoff {
+		return c.opts.MaxBackoff
+	}
+	return backoff
+}
+
+// waitChannels blocks until the client is connected and returns the current
+// publishing and consuming channels, or ErrClosed once the client is closed
+// or cancel is closed.
+func (c *client) waitChannels(cancel <-chan struct{}) (*publishChannel, *amqp.Channel, error) {
+	for {
+		c.mu.RLock()
+		ready, publisher, consumer, connected, closed := c.ready, c.publisher, c.consumer, c.connected, c.closed
+		c.mu.RUnlock()
+
+		if closed {
+			return nil, nil, ErrClosed
+		}
+		if connected {
+			return publisher, consumer, nil
+		}
+
+		select {
+		case <-ready:
+		case <-c.done:
+			return nil, nil, ErrClosed
+		case <-cancel:
+			return nil, nil, ErrClosed
+		}
+	}
+}
+
 func (c *client) ExchangeDeclare(opts *ExchangeOptions) error {
-	return c.channel.ExchangeDeclare(
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.connected {
+		return ErrNotConnected
+	}
+	err := exchangeDeclare(c.publisher.channel, opts)
+	if err != nil {
+		return err
+	}
+	c.exchanges = append(c.exchanges, opts)
+	return nil
+}
+
+func exchangeDeclare(channel *amqp.Channel, opts *ExchangeOptions) error {
+	return channel.ExchangeDeclare(
 		opts.Name,
 		opts.Kind,
 		opts.Durable,
@@ -67,7 +283,21 @@ func (c *client) ExchangeDeclare(opts *ExchangeOptions) error {
 }
 
 func (c *client) QueueDeclare(opts *QueueOptions) error {
-	queue, err := c.channel.QueueDeclare(
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.connected {
+		return ErrNotConnected
+	}
+	err := queueDeclare(c.publisher.channel, opts)
+	if err != nil {
+		return err
+	}
+	c.queues = append(c.queues, opts)
+	return nil
+}
+
+func queueDeclare(channel *amqp.Channel, opts *QueueOptions) error {
+	queue, err := channel.QueueDeclare(
 		opts.Name,
 		opts.Durable,
 		opts.AutoDelete,
@@ -83,7 +313,7 @@ func (c *client) QueueDeclare(opts *QueueOptions) error {
 
 		bindOpts := opts.BindOptions
 
-		err = c.channel.QueueBind(
+		err = channel.QueueBind(
 			queue.Name,
 			bindOpts.RoutingKey,
 			bindOpts.ExchangeName,
@@ -94,84 +324,144 @@ func (c *client) QueueDeclare(opts *QueueOptions) error {
 			return err
 		}
 	}
+
+	if opts.Retry != nil {
+		return declareRetryTopology(channel, queue.Name, opts.Retry)
+	}
 	return nil
 }
 
-func (c *client) Listen(opts *ConsumerOptions) error {
+func (c *client) retryOptions(queue string) *RetryOptions {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, opts := range c.queues {
+		if opts.Name == queue {
+			return opts.Retry
+		}
+	}
+	return nil
+}
 
-	messages, err := c.channel.Consume(
-		opts.QueueName,
-		opts.Consumer,
-		opts.AutoAck,
-		opts.Exclusive,
-		opts.NoLocal,
-		opts.NoWait,
-		opts.Args,
-	)
+func (c *client) Send(opts *PublisherOptions) error {
+	out, err := newOutgoing(opts)
 	if err != nil {
 		return err
 	}
 
-	for message := range messages {
+	c.mu.RLock()
+	publisher, connected, closed := c.publisher, c.connected, c.closed
+	c.mu.RUnlock()
 
-		var msg Message
-		err := json.Unmarshal(message.Body, &msg)
-		if err != nil {
-			return err
-		}
-
-		if !opts.AutoAck {
-			err := message.Ack(false)
-			if err != nil {
-				return err
-			}
-		}
-
-		handler, ok := c.handlers[msg.Type]
-		if !ok {
-			log.Printf("received message without registered handler: MessageType=%s", msg.Type)
-			continue
-		}
-
-		err = handler(msg.Data)
-		if err != nil {
-			log.Printf("error on handler message: err=%s data=%s\n", err, msg.Data)
-		}
+	if closed {
+		return ErrClosed
+	}
+	if !connected {
+		return c.buffer(out)
 	}
 
-	return nil
+	err = c.publish(publisher, out)
+	if err == amqp.ErrClosed {
+		return c.buffer(out)
+	}
+	return err
 }
 
-func (c *client) HandleFunc(messageType interface{}, handler func(data []byte) error) {
-	c.handlers[fmt.Sprintf("%T", messageType)] = handler
+// outgoing is a message ready to be published.
+type outgoing struct {
+	exchange  string
+	key       string
+	mandatory bool
+	immediate bool
+	msg       amqp.Publishing
 }
 
-func (c *client) Send(opts *PublisherOptions) error {
+func newOutgoing(opts *PublisherOptions) (*outgoing, error) {
+	if opts.Message == nil {
+		return nil, errors.New("rmq: message is required")
+	}
+	message := publishing(opts.Message)
 
-	body, err := json.Marshal(opts.Message)
-	if err != nil {
-		return err
+	if opts.Persistent {
+		message.DeliveryMode = amqp.Persistent
 	}
 
-	message := amqp.Publishing{
-		ContentType: "application/json",
-		Body:        body,
+	return &outgoing{
+		exchange:  opts.ExchangeName,
+		key:       opts.RoutingKey,
+		mandatory: opts.Mandatory,
+		immediate: opts.Immediate,
+		msg:       message,
+	}, nil
+}
+
+// publish sends the message on the channel, waiting for the broker confirm
+// when the client is in confirm mode. Every publish on a confirm mode channel
+// must go through here, otherwise delivery tags get out of step.
+func (c *client) publish(publisher *publishChannel, out *outgoing) error {
+	if publisher.confirms != nil {
+		return publisher.confirms.publish(publisher.channel, out, c.opts.ConfirmTimeout)
 	}
+	return publisher.channel.Publish(out.exchange, out.key, out.mandatory, out.immediate, out.msg)
+}
 
-	if opts.Persistent {
-		message.DeliveryMode = amqp.Persistent
+func (c *client) buffer(out *outgoing) error {
+	if c.opts.Confirm {
+		return ErrNotConnected
 	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.connected {
+		err := c.publish(c.publisher, out)
+		if err != amqp.ErrClosed {
+			return err
+		}
+	}
+	if c.opts.PublishBuffer == 0 {
+		return ErrNotConnected
+	}
+	if len(c.pending) >= c.opts.PublishBuffer {
+		return ErrBufferFull
+	}
+	c.pending = append(c.pending, out)
+	return nil
+}
 
-	return c.channel.Publish(
-		opts.ExchangeName,
-		opts.RoutingKey,
-		opts.Mandatory,
-		opts.Immediate,
-		message,
-	)
+// flush publishes the messages buffered during an outage. It must be called
+// with the lock held.
+func (c *client) flush() {
+	for len(c.pending) > 0 {
+		err := c.publish(c.publisher, c.pending[0])
+		if err != nil {
+			logging.Default().Error("error on flush buffered messages", "pending", len(c.pending), "err", err)
+			return
+		}
+		c.pending = c.pending[1:]
+	}
 }
 
 func (c *client) Close() {
-	utils.HandleClose(c.channel)
-	utils.HandleClose(c.conn)
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.DrainTimeout)
+	defer cancel()
+	err := c.Stop(ctx)
+	if err != nil {
+		logging.Default().Warn("rabbitmq consumers not drained", "err", err)
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	c.connected = false
+	close(c.done)
+	publisher, consumer, conn := c.publisher, c.consumer, c.conn
+	if len(c.pending) > 0 {
+		logging.Default().Warn("rabbitmq closed with buffered messages", "pending", len(c.pending))
+	}
+	c.mu.Unlock()
+
+	utils.HandleClose(consumer)
+	utils.HandleClose(publisher.channel)
+	utils.HandleClose(conn)
 }
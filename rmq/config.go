@@ -1,36 +1,17 @@
 package rmq
 
 import (
-	"flag"
 	"fmt"
-	"log"
-	"os"
-	"strconv"
+	"net/url"
 )
 
-var (
-	rmqUser string
-	rmqPass string
-	rmqHost string
-	rmqPort int
-)
-
-func LoadConfigFromEnv() {
-	rmqUser = os.Getenv("RABBITMQ_USER")
-	rmqPass = os.Getenv("RABBITMQ_PASS")
-	rmqHost = os.Getenv("RABBITMQ_HOST")
-	var err error
-	rmqPort, err = strconv.Atoi(os.Getenv("RABBITMQ_PORT"))
-	if err != nil {
-		log.Panicln(err)
-	}
-}
-
-func LoadConfigFromFlags(flagSet *flag.FlagSet) {
-	flag.StringVar(&rmqUser, "rmq_user", "guest", "rabbitmq user")
-	flag.StringVar(&rmqPass, "rmq_pass", "guest", "rabbitmq password")
-	flag.StringVar(&rmqHost, "rmq_host", "localhost", "rabbitmq host")
-	flag.IntVar(&rmqPort, "rmq_port", 5672, "rabbitmq port")
+// ConnectionOptions describe how to reach RabbitMQ.
+type ConnectionOptions struct {
+	User  string
+	Pass  string
+	Host  string
+	Port  int
+	VHost string
 }
 
 type Config interface {
@@ -38,21 +19,21 @@ type Config interface {
 }
 
 type config struct {
-	rmqUser string
-	rmqPass string
-	rmqHost string
-	rmqPort int
+	opts ConnectionOptions
 }
 
-func NewConfig() Config {
-	return &config{
-		rmqUser: rmqUser,
-		rmqPass: rmqPass,
-		rmqHost: rmqHost,
-		rmqPort: rmqPort,
-	}
+func NewConfig(opts *ConnectionOptions) Config {
+	return &config{opts: *opts}
 }
 
 func (cfg *config) URL() string {
-	return fmt.Sprintf("amqp://%s:%s@%s:%d/", cfg.rmqUser, cfg.rmqPass, cfg.rmqHost, cfg.rmqPort)
+	u := url.URL{
+		Scheme: "amqp",
+		User:   url.UserPassword(cfg.opts.User, cfg.opts.Pass),
+		Host:   fmt.Sprintf("%s:%d", cfg.opts.Host, cfg.opts.Port),
+		// the default vhost "/" must be sent escaped
+		Path:    "/" + cfg.opts.VHost,
+		RawPath: "/" + url.PathEscape(cfg.opts.VHost),
+	}
+	return u.String()
 }
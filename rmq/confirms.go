@@ -0,0 +1,182 @@
+package rmq
+
+import (
+	"github.com/streadway/amqp"
+	"go-temporal-workflow/bus"
+	"go-temporal-workflow/logging"
+	"sync"
+	"time"
+)
+
+type pendingConfirm struct {
+	messageID string
+	result    chan error
+}
+
+// confirms tracks messages published in confirm mode on one channel until
+// the broker acks, nacks or returns them. Delivery tags restart from one on
+// every channel, so every channel gets its own tracker and a closing channel
+// only fails the confirms that were in flight on it.
+type confirms struct {
+	publishMu   sync.Mutex
+	deliveryTag uint64
+
+	mu       sync.Mutex
+	inflight map[uint64]*pendingConfirm
+	returned map[string]*amqp.Return
+}
+
+// watchConfirms puts channel in confirm mode. It must be called before
+// anything is published on the channel.
+func watchConfirms(channel *amqp.Channel) (*confirms, error) {
+	err := channel.Confirm(false)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &confirms{
+		inflight: make(map[uint64]*pendingConfirm),
+		returned: make(map[string]*amqp.Return),
+	}
+	acks := channel.NotifyPublish(make(chan amqp.Confirmation, 64))
+	returns := channel.NotifyReturn(make(chan amqp.Return, 64))
+
+	go c.dispatch(acks, returns)
+	return c, nil
+}
+
+func (c *confirms) dispatch(acks <-chan amqp.Confirmation, returns <-chan amqp.Return) {
+	for {
+		select {
+		case r, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			c.addReturn(r)
+		case ack, ok := <-acks:
+			if !ok {
+				c.failAll(ErrNotConnected)
+				return
+			}
+			// the broker sends basic.return before the ack of the same
+			// message, drain them so the ack sees its return
+			c.drainReturns(returns)
+			c.resolve(ack)
+		}
+	}
+}
+
+func (c *confirms) drainReturns(returns <-chan amqp.Return) {
+	for {
+		select {
+		case r, ok := <-returns:
+			if !ok {
+				return
+			}
+			c.addReturn(r)
+		default:
+			return
+		}
+	}
+}
+
+func (c *confirms) addReturn(r amqp.Return) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if r.MessageId == "" {
+		logging.Default().Warn("message returned", "exchange", r.Exchange, "routing_key", r.RoutingKey, "reason", r.ReplyText)
+		return
+	}
+	c.returned[r.MessageId] = &r
+}
+
+func (c *confirms) resolve(ack amqp.Confirmation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.inflight[ack.DeliveryTag]
+	if !ok {
+		return
+	}
+	delete(c.inflight, ack.DeliveryTag)
+
+	r, returned := c.returned[p.messageID]
+	delete(c.returned, p.messageID)
+
+	switch {
+	case !ack.Ack:
+		p.result <- ErrNacked
+	case returned:
+		p.result <- &ReturnError{
+			Exchange:   r.Exchange,
+			RoutingKey: r.RoutingKey,
+			ReplyCode:  r.ReplyCode,
+			ReplyText:  r.ReplyText,
+		}
+	default:
+		p.result <- nil
+	}
+}
+
+func (c *confirms) failAll(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for tag, p := range c.inflight {
+		p.result <- err
+		delete(c.inflight, tag)
+	}
+	c.returned = make(map[string]*amqp.Return)
+}
+
+// publish sends the message and waits for the broker to confirm it.
+func (c *confirms) publish(channel *amqp.Channel, out *outgoing, timeout time.Duration) error {
+	if out.msg.MessageId == "" {
+		out.msg.MessageId = newMessageID()
+	}
+	p := &pendingConfirm{
+		messageID: out.msg.MessageId,
+		result:    make(chan error, 1),
+	}
+
+	c.publishMu.Lock()
+	tag := c.deliveryTag + 1
+
+	c.mu.Lock()
+	c.inflight[tag] = p
+	c.mu.Unlock()
+
+	err := channel.Publish(out.exchange, out.key, out.mandatory, out.immediate, out.msg)
+	if err != nil {
+		c.publishMu.Unlock()
+		c.forget(tag, p.messageID)
+		if err == amqp.ErrClosed {
+			return ErrNotConnected
+		}
+		return err
+	}
+	c.deliveryTag = tag
+	c.publishMu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-p.result:
+		return err
+	case <-timer.C:
+		c.forget(tag, p.messageID)
+		return ErrConfirmTimeout
+	}
+}
+
+func (c *confirms) forget(tag uint64, messageID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.inflight, tag)
+	delete(c.returned, messageID)
+}
+
+func newMessageID() string {
+	return bus.NewID()
+}
@@ -0,0 +1,233 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"github.com/streadway/amqp"
+	"go-temporal-workflow/bus"
+	"go-temporal-workflow/logging"
+	"time"
+)
+
+// Listen consumes the queue until the client is closed or Stop is called.
+// When the connection drops it waits for the supervisor to reconnect and
+// consumes again. Deliveries are handed to a pool of opts.Workers goroutines
+// and Listen returns only after the pool has drained.
+func (c *client) Listen(opts *ConsumerOptions) error {
+	c.listeners.Add(1)
+	defer c.listeners.Done()
+
+	tag := opts.Consumer
+	if tag == "" {
+		tag = "ctag-" + newMessageID()
+	}
+
+	pool := bus.NewWorkerPool(opts.Workers, opts.Prefetch)
+	defer pool.Drain()
+
+	retry := c.retryOptions(opts.QueueName)
+	for {
+		publisher, channel, err := c.waitChannels(c.stopping)
+		if err == ErrClosed {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		messages, err := c.consume(channel, tag, opts)
+		if err != nil {
+			logging.Default().Error("error on consume", "queue", opts.QueueName, "err", err)
+			time.Sleep(c.opts.InitialBackoff)
+			continue
+		}
+
+		for message := range messages {
+			d := message
+			pool.Submit(keyOf(opts, &d), func() {
+				c.handle(publisher, &d, opts, retry)
+			})
+		}
+
+		c.mu.Lock()
+		delete(c.consumers, tag)
+		c.mu.Unlock()
+
+		select {
+		case <-c.stopping:
+			logging.Default().Info("consumer stopped", "queue", opts.QueueName)
+			return nil
+		default:
+		}
+		logging.Default().Warn("consumer interrupted", "queue", opts.QueueName)
+	}
+}
+
+func (c *client) consume(channel *amqp.Channel, tag string, opts *ConsumerOptions) (<-chan amqp.Delivery, error) {
+	// registering under the lock keeps Stop from missing a consumer that is
+	// just starting
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	select {
+	case <-c.stopping:
+		return nil, ErrClosed
+	default:
+	}
+
+	if opts.Prefetch > 0 {
+		err := channel.Qos(opts.Prefetch, 0, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	messages, err := channel.Consume(
+		opts.QueueName,
+		tag,
+		opts.AutoAck,
+		opts.Exclusive,
+		opts.NoLocal,
+		opts.NoWait,
+		opts.Args,
+	)
+	if err != nil {
+		return nil, err
+	}
+	c.consumers[tag] = channel
+	return messages, nil
+}
+
+// Stop cancels the consumers so no new messages are delivered, then waits
+// for Listen to finish the messages already delivered. Unacked messages
+// still queued when ctx is done are redelivered by the broker once the
+// channel closes.
+func (c *client) Stop(ctx context.Context) error {
+	c.stopOnce.Do(func() {
+		c.mu.Lock()
+		close(c.stopping)
+		consumers := c.consumers
+		c.consumers = make(map[string]*amqp.Channel)
+		c.mu.Unlock()
+
+		for tag, channel := range consumers {
+			err := channel.Cancel(tag, false)
+			if err != nil {
+				logging.Default().Error("error on cancel consumer", "tag", tag, "err", err)
+			}
+		}
+	})
+
+	done := make(chan struct{})
+	go func() {
+		c.listeners.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func keyOf(opts *ConsumerOptions, d *amqp.Delivery) string {
+	if opts.KeyFunc == nil {
+		return ""
+	}
+	msg, err := decodeMessage(d)
+	if err != nil {
+		return ""
+	}
+	return opts.KeyFunc(msg)
+}
+
+// handle runs the handler and only then acks the message. Failed messages
+// are republished to a retry queue or to the dead-letter exchange before the
+// original is acked, so a crash in between redelivers instead of losing it.
+func (c *client) handle(publisher *publishChannel, message *amqp.Delivery, opts *ConsumerOptions, retry *RetryOptions) {
+	err := c.dispatch(message)
+	logger := messageLogger(message)
+	if opts.AutoAck {
+		if err != nil {
+			logger.Error("error on handle message", "err", err, "body", string(message.Body))
+		}
+		return
+	}
+	if err == nil {
+		err = message.Ack(false)
+		if err != nil {
+			logger.Error("error on ack message", "err", err)
+		}
+		return
+	}
+
+	logger.Error("error on handle message", "err", err, "body", string(message.Body))
+
+	if retry == nil {
+		// without retry topology a failed message goes back to the queue
+		// once, permanent failures are dropped
+		requeue := !message.Redelivered && !errors.Is(err, ErrPermanent)
+		err = message.Nack(false, requeue)
+		if err != nil {
+			logger.Error("error on nack message", "err", err)
+		}
+		return
+	}
+
+	err = c.retry(publisher, message, opts.QueueName, retry, err)
+	if err != nil {
+		logger.Error("error on retry message", "err", err)
+		err = message.Nack(false, true)
+		if err != nil {
+			logger.Error("error on nack message", "err", err)
+		}
+		return
+	}
+	err = message.Ack(false)
+	if err != nil {
+		logger.Error("error on ack message", "err", err)
+	}
+}
+
+// messageLogger logs with the ids of the delivery, so failures can be
+// traced back to the request that published it.
+func messageLogger(message *amqp.Delivery) logging.Logger {
+	requestID, _ := message.Headers[HeaderRequestID].(string)
+	return logging.Default().With("message_id", message.MessageId, "type", message.Type, logging.RequestIDKey, requestID)
+}
+
+func (c *client) dispatch(message *amqp.Delivery) error {
+	msg, err := decodeMessage(message)
+	if err != nil {
+		return Permanent(err)
+	}
+	return c.handlers.Dispatch(msg)
+}
+
+func (c *client) retry(publisher *publishChannel, message *amqp.Delivery, queue string, retry *RetryOptions, cause error) error {
+	n := attempts(message.Headers) + 1
+	headers := amqp.Table{
+		HeaderAttempts:      int32(n),
+		HeaderLastError:     cause.Error(),
+		HeaderOriginalQueue: queue,
+	}
+
+	if n < retry.MaxAttempts && len(retry.Delays) > 0 && !errors.Is(cause, ErrPermanent) {
+		key := retryQueueName(queue, retry.delayLevel(n))
+		return c.publish(publisher, redirect(message, "", key, headers))
+	}
+
+	headers[HeaderDeadLetterAt] = time.Now().Unix()
+	messageLogger(message).Warn("message dead-lettered", "queue", queue, "attempts", n, "err", cause)
+	return c.publish(publisher, redirect(message, DeadLetterName(queue), "", headers))
+}
+
+func (c *client) HandleFunc(name string, version int, fn func(msg *Message) error) {
+	c.handlers.HandleFunc(name, version, fn)
+}
+
+func (c *client) Upcast(name string, from int, upcaster Upcaster) {
+	c.handlers.Upcast(name, from, upcaster)
+}
@@ -0,0 +1,115 @@
+package rmq
+
+import (
+	"github.com/streadway/amqp"
+	"go-temporal-workflow/bus"
+	"go-temporal-workflow/utils"
+	"time"
+)
+
+type DeadLetter = bus.DeadLetter
+
+func newDeadLetter(d *amqp.Delivery) *DeadLetter {
+	dl := &DeadLetter{
+		MessageID: d.MessageId,
+		Type:      d.Type,
+		Data:      d.Body,
+		Attempts:  attempts(d.Headers),
+	}
+	msg, err := decodeMessage(d)
+	if err == nil {
+		dl.Type = msg.Type
+		dl.Version = msg.Version
+		dl.CorrelationID = msg.CorrelationID
+		dl.Data = msg.Data
+	}
+	if v, ok := d.Headers[HeaderLastError].(string); ok {
+		dl.LastError = v
+	}
+	if v, ok := d.Headers[HeaderOriginalQueue].(string); ok {
+		dl.OriginalQueue = v
+	}
+	if v, ok := d.Headers[HeaderDeadLetterAt].(int64); ok {
+		dl.DeadLetteredAt = time.Unix(v, 0).UTC()
+	}
+	return dl
+}
+
+// Peek returns up to limit messages from the dead-letter queue of queue
+// without removing them. The messages are fetched on a separate channel and
+// put back when it is closed.
+func (c *client) Peek(queue string, limit int) ([]*DeadLetter, error) {
+	channel, err := c.openChannel()
+	if err != nil {
+		return nil, err
+	}
+	defer utils.HandleClose(channel)
+
+	letters := make([]*DeadLetter, 0)
+	for len(letters) < limit {
+		d, ok, err := channel.Get(DeadLetterName(queue), false)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		letters = append(letters, newDeadLetter(&d))
+	}
+	return letters, nil
+}
+
+// Replay moves up to limit messages from the dead-letter queue of queue back
+// to the queue with their attempts reset. It returns how many were replayed.
+func (c *client) Replay(queue string, limit int) (int, error) {
+	channel, err := c.openChannel()
+	if err != nil {
+		return 0, err
+	}
+	defer utils.HandleClose(channel)
+
+	replayed := 0
+	for replayed < limit {
+		d, ok, err := channel.Get(DeadLetterName(queue), false)
+		if err != nil {
+			return replayed, err
+		}
+		if !ok {
+			break
+		}
+
+		out := redirect(&d, "", queue, nil)
+		delete(out.msg.Headers, HeaderAttempts)
+		delete(out.msg.Headers, HeaderLastError)
+		delete(out.msg.Headers, HeaderDeadLetterAt)
+
+		publisher, _, err := c.waitChannels(nil)
+		if err != nil {
+			return replayed, err
+		}
+		err = c.publish(publisher, out)
+		if err != nil {
+			return replayed, err
+		}
+		err = d.Ack(false)
+		if err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+func (c *client) openChannel() (*amqp.Channel, error) {
+	c.mu.RLock()
+	conn, connected, closed := c.conn, c.connected, c.closed
+	c.mu.RUnlock()
+
+	if closed {
+		return nil, ErrClosed
+	}
+	if !connected {
+		return nil, ErrNotConnected
+	}
+	return conn.Channel()
+}
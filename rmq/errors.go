@@ -0,0 +1,37 @@
+package rmq
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotDelivered is wrapped by every error meaning the broker did not
+// durably accept a published message.
+var ErrNotDelivered = errors.New("rabbitmq: message not delivered")
+
+var (
+	ErrNotConnected   = fmt.Errorf("%w: not connected", ErrNotDelivered)
+	ErrNacked         = fmt.Errorf("%w: nacked by broker", ErrNotDelivered)
+	ErrReturned       = fmt.Errorf("%w: returned by broker", ErrNotDelivered)
+	ErrConfirmTimeout = fmt.Errorf("%w: confirm timeout", ErrNotDelivered)
+	ErrBufferFull     = errors.New("rabbitmq: publish buffer full")
+	ErrClosed         = errors.New("rabbitmq: client closed")
+)
+
+// ReturnError is returned for mandatory messages that could not be routed
+// to any queue.
+type ReturnError struct {
+	Exchange   string
+	RoutingKey string
+	ReplyCode  uint16
+	ReplyText  string
+}
+
+func (e *ReturnError) Error() string {
+	return fmt.Sprintf("%s: exchange=%s routing_key=%s code=%d reason=%s",
+		ErrReturned, e.Exchange, e.RoutingKey, e.ReplyCode, e.ReplyText)
+}
+
+func (e *ReturnError) Unwrap() error {
+	return ErrReturned
+}
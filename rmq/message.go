@@ -0,0 +1,118 @@
+package rmq
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/streadway/amqp"
+	"go-temporal-workflow/bus"
+)
+
+const (
+	HeaderVersion     = "x-version"
+	HeaderCausationID = "x-causation-id"
+	HeaderRequestID   = "x-request-id"
+)
+
+// The envelope and its registry are transport neutral and live in the bus
+// package. On the wire the data is the body and the other fields travel in
+// the AMQP properties: ID as message-id, Type as type, CorrelationID as
+// correlation-id and ReplyTo as reply-to, with the version, causation id and
+// request id in headers.
+type (
+	Message  = bus.Message
+	Upcaster = bus.Upcaster
+)
+
+var (
+	ErrUnregisteredType = bus.ErrUnregisteredType
+	ErrUnknownVersion   = bus.ErrUnknownVersion
+)
+
+func RegisterType(name string, version int, v interface{}) {
+	bus.RegisterType(name, version, v)
+}
+
+func NewMessage(m interface{}) (*Message, error) {
+	return bus.NewMessage(m)
+}
+
+func NewMessageFrom(cause *Message, m interface{}) (*Message, error) {
+	return bus.NewMessageFrom(cause, m)
+}
+
+func publishing(m *Message) amqp.Publishing {
+	headers := amqp.Table{
+		HeaderVersion: int32(m.Version),
+	}
+	if m.CausationID != "" {
+		headers[HeaderCausationID] = m.CausationID
+	}
+	if m.RequestID != "" {
+		headers[HeaderRequestID] = m.RequestID
+	}
+	return amqp.Publishing{
+		Headers:       headers,
+		ContentType:   "application/json",
+		MessageId:     m.ID,
+		Type:          m.Type,
+		Timestamp:     m.Timestamp,
+		CorrelationId: m.CorrelationID,
+		ReplyTo:       m.ReplyTo,
+		Body:          m.Data,
+	}
+}
+
+// decodeMessage reads the envelope of a delivery. Deliveries without a type
+// property were published before the envelope, as a JSON body holding the
+// Go type name and the data.
+func decodeMessage(d *amqp.Delivery) (*Message, error) {
+	if d.Type == "" {
+		return decodeLegacy(d)
+	}
+	msg := &Message{
+		ID:            d.MessageId,
+		Type:          d.Type,
+		Version:       1,
+		Timestamp:     d.Timestamp,
+		CorrelationID: d.CorrelationId,
+		ReplyTo:       d.ReplyTo,
+		Data:          d.Body,
+	}
+	switch v := d.Headers[HeaderVersion].(type) {
+	case int32:
+		msg.Version = int(v)
+	case int64:
+		msg.Version = int(v)
+	}
+	if v, ok := d.Headers[HeaderCausationID].(string); ok {
+		msg.CausationID = v
+	}
+	if v, ok := d.Headers[HeaderRequestID].(string); ok {
+		msg.RequestID = v
+	}
+	return msg, nil
+}
+
+func decodeLegacy(d *amqp.Delivery) (*Message, error) {
+	var legacy struct {
+		Type string
+		Data []byte
+	}
+	err := json.Unmarshal(d.Body, &legacy)
+	if err != nil {
+		return nil, err
+	}
+	name, ok := bus.LegacyType(legacy.Type)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnregisteredType, legacy.Type)
+	}
+	return &Message{
+		ID:            d.MessageId,
+		Type:          name,
+		Version:       1,
+		Timestamp:     d.Timestamp,
+		CorrelationID: d.MessageId,
+		ReplyTo:       d.ReplyTo,
+		Data:          legacy.Data,
+	}, nil
+}
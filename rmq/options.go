@@ -1,11 +1,44 @@
 package rmq
 
 import (
-	"encoding/json"
-	"fmt"
 	"github.com/streadway/amqp"
+	"time"
 )
 
+// ClientOptions controls how the client recovers from a lost connection
+// and how publishing is acknowledged.
+//
+// With Confirm set the publishing channel is put in publisher confirm mode and Send
+// waits up to ConfirmTimeout for the broker to ack the message. Send calls
+// made while disconnected fail fast with ErrNotConnected.
+//
+// Without Confirm, Send calls made while disconnected are buffered up to
+// PublishBuffer messages and published after reconnecting. With
+// PublishBuffer zero they fail fast as well.
+//
+// Close stops the consumers and waits up to DrainTimeout for the messages
+// being handled before closing the connection.
+type ClientOptions struct {
+	DialAttempts   int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	PublishBuffer  int
+	Confirm        bool
+	ConfirmTimeout time.Duration
+	DrainTimeout   time.Duration
+}
+
+func DefaultClientOptions() *ClientOptions {
+	return &ClientOptions{
+		DialAttempts:   5,
+		InitialBackoff: time.Millisecond * 500,
+		MaxBackoff:     time.Second * 30,
+		Confirm:        true,
+		ConfirmTimeout: time.Second * 5,
+		DrainTimeout:   time.Second * 30,
+	}
+}
+
 type ExchangeOptions struct {
 	Name       string
 	Kind       string
@@ -23,6 +56,7 @@ type QueueOptions struct {
 	Exclusive   bool
 	NoWait      bool
 	BindOptions *QueueBindOptions
+	Retry       *RetryOptions
 	Args        amqp.Table
 }
 
@@ -33,6 +67,13 @@ type QueueBindOptions struct {
 	Args         amqp.Table
 }
 
+// ConsumerOptions configures Listen. Messages are handled by Workers
+// goroutines, one when unset, with at most Prefetch unacked messages
+// delivered at a time, unlimited when unset.
+//
+// KeyFunc returns the ordering key of a message. Messages with the same key
+// are handled one at a time in the order they were delivered, messages with
+// different keys run in parallel. Without KeyFunc there is no ordering.
 type ConsumerOptions struct {
 	QueueName string
 	Consumer  string
@@ -40,6 +81,9 @@ type ConsumerOptions struct {
 	Exclusive bool
 	NoLocal   bool
 	NoWait    bool
+	Prefetch  int
+	Workers   int
+	KeyFunc   func(msg *Message) string
 	Args      amqp.Table
 }
 
@@ -51,17 +95,3 @@ type PublisherOptions struct {
 	Persistent   bool
 	Message      *Message
 }
-
-type Message struct {
-	Type string
-	Data []byte
-}
-
-func NewMessage(m interface{}) *Message {
-	typ := fmt.Sprintf("%T", m)
-	body, _ := json.Marshal(m)
-	return &Message{
-		Type: typ,
-		Data: body,
-	}
-}
@@ -0,0 +1,127 @@
+package rmq
+
+import (
+	"fmt"
+	"github.com/streadway/amqp"
+	"go-temporal-workflow/bus"
+	"time"
+)
+
+const (
+	HeaderAttempts      = "x-attempts"
+	HeaderLastError     = "x-last-error"
+	HeaderOriginalQueue = "x-original-queue"
+	HeaderDeadLetterAt  = "x-dead-lettered-at"
+)
+
+// RetryOptions enables retries for a queue. A message whose handler fails is
+// published to a delay queue and comes back to the original queue after the
+// delay of its attempt, the last delay being reused for later attempts. After
+// MaxAttempts it is published to the queue's dead-letter exchange.
+//
+// For a queue named "subscriptions" the topology is:
+//
+//	subscriptions.retry.<n>  delay queues, dead-lettering back to the queue
+//	subscriptions.dead       dead-letter exchange and its queue
+type RetryOptions struct {
+	MaxAttempts int
+	Delays      []time.Duration
+}
+
+func retryQueueName(queue string, level int) string {
+	return fmt.Sprintf("%s.retry.%d", queue, level)
+}
+
+func DeadLetterName(queue string) string {
+	return queue + ".dead"
+}
+
+func (r *RetryOptions) delayLevel(attempts int) int {
+	level := attempts - 1
+	if level >= len(r.Delays) {
+		level = len(r.Delays) - 1
+	}
+	if level < 0 {
+		level = 0
+	}
+	return level
+}
+
+func declareRetryTopology(channel *amqp.Channel, queue string, retry *RetryOptions) error {
+	for level, delay := range retry.Delays {
+		_, err := channel.QueueDeclare(
+			retryQueueName(queue, level),
+			true,
+			false,
+			false,
+			false,
+			amqp.Table{
+				"x-message-ttl":             int64(delay / time.Millisecond),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": queue,
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	deadLetter := DeadLetterName(queue)
+	err := channel.ExchangeDeclare(deadLetter, amqp.ExchangeFanout, true, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+	_, err = channel.QueueDeclare(deadLetter, true, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+	return channel.QueueBind(deadLetter, "", deadLetter, false, nil)
+}
+
+// ErrPermanent marks handler errors that retrying can't fix. Such messages
+// are dead-lettered on the first failure.
+var ErrPermanent = bus.ErrPermanent
+
+func Permanent(err error) error {
+	return bus.Permanent(err)
+}
+
+func attempts(headers amqp.Table) int {
+	switch v := headers[HeaderAttempts].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
+
+// redirect copies the delivery into a new message with the given headers
+// set, keeping its body and properties.
+func redirect(d *amqp.Delivery, exchange, key string, headers amqp.Table) *outgoing {
+	table := amqp.Table{}
+	for k, v := range d.Headers {
+		table[k] = v
+	}
+	for k, v := range headers {
+		table[k] = v
+	}
+	return &outgoing{
+		exchange: exchange,
+		key:      key,
+		msg: amqp.Publishing{
+			Headers:         table,
+			ContentType:     d.ContentType,
+			ContentEncoding: d.ContentEncoding,
+			DeliveryMode:    amqp.Persistent,
+			CorrelationId:   d.CorrelationId,
+			ReplyTo:         d.ReplyTo,
+			MessageId:       d.MessageId,
+			Timestamp:       d.Timestamp,
+			Type:            d.Type,
+			Body:            d.Body,
+		},
+	}
+}
@@ -0,0 +1,124 @@
+package rmq
+
+import (
+	"github.com/streadway/amqp"
+	"go-temporal-workflow/bus"
+	"go-temporal-workflow/logging"
+	"time"
+)
+
+// DirectReplyTo is the RabbitMQ pseudo queue that routes replies straight
+// to the channel that consumes it, without declaring a reply queue.
+const DirectReplyTo = "amq.rabbitmq.reply-to"
+
+var ErrRequestTimeout = bus.ErrRequestTimeout
+
+// replies receives the replies of the requests published by the client.
+type replies struct {
+	*bus.Replies
+}
+
+func newReplies() *replies {
+	return &replies{Replies: bus.NewReplies()}
+}
+
+// consume receives the replies on channel. Direct reply-to requires the
+// requests to be published on the same channel.
+func (r *replies) consume(channel *amqp.Channel) error {
+	deliveries, err := channel.Consume(DirectReplyTo, "", true, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for d := range deliveries {
+			msg, err := decodeMessage(&d)
+			if err != nil {
+				logging.Default().Error("error on decode reply", "err", err)
+				continue
+			}
+			if !r.Resolve(msg) {
+				logging.Default().Warn("reply without waiting request", "causation_id", msg.CausationID)
+			}
+		}
+	}()
+	return nil
+}
+
+// Request publishes the message with reply-to set and waits up to timeout
+// for the reply. Requests are never buffered, they fail with
+// ErrNotConnected during an outage.
+func (c *client) Request(opts *PublisherOptions, timeout time.Duration) (*Message, error) {
+	request := *opts
+	msg := *opts.Message
+	msg.ReplyTo = DirectReplyTo
+	request.Message = &msg
+
+	out, err := newOutgoing(&request)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	publisher, connected, closed := c.publisher, c.connected, c.closed
+	c.mu.RUnlock()
+
+	if closed {
+		return nil, ErrClosed
+	}
+	if !connected {
+		return nil, ErrNotConnected
+	}
+
+	reply := c.replies.Add(msg.ID)
+	defer c.replies.Remove(msg.ID)
+
+	err = c.publish(publisher, out)
+	if err == amqp.ErrClosed {
+		return nil, ErrNotConnected
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bus.Wait(reply, timeout)
+}
+
+// Await sets reply-to on a copy of msg, lets send publish it and waits up to
+// timeout for the reply. The broker routes the reply to the channel that
+// published the request, so it only arrives when send publishes through
+// this client, as the outbox relay of the same process does.
+func (c *client) Await(msg *Message, send func(msg *Message) error, timeout time.Duration) (*Message, error) {
+	c.mu.RLock()
+	closed := c.closed
+	c.mu.RUnlock()
+	if closed {
+		return nil, ErrClosed
+	}
+
+	request := *msg
+	request.ReplyTo = DirectReplyTo
+
+	reply := c.replies.Add(request.ID)
+	defer c.replies.Remove(request.ID)
+
+	err := send(&request)
+	if err != nil {
+		return nil, err
+	}
+	return bus.Wait(reply, timeout)
+}
+
+// Reply publishes v as the reply to request. It does nothing when the
+// request doesn't expect a reply.
+func (c *client) Reply(request *Message, v interface{}) error {
+	if request.ReplyTo == "" {
+		return nil
+	}
+	msg, err := NewMessageFrom(request, v)
+	if err != nil {
+		return err
+	}
+	return c.Send(&PublisherOptions{
+		RoutingKey: request.ReplyTo,
+		Message:    msg,
+	})
+}
@@ -0,0 +1,177 @@
+package lockout
+
+import (
+	"context"
+	"fmt"
+	"go-temporal-workflow/models"
+	"go-temporal-workflow/store"
+	"strings"
+	"time"
+)
+
+// Policy controls how failed sign in attempts are throttled. The first
+// FreeAttempts failures are not delayed, after that every failure doubles the
+// delay starting from BaseDelay, up to MaxDelay. Reaching MaxFailures locks
+// the key for LockoutDuration. Failures are forgotten Window after the last
+// attempt.
+type Policy struct {
+	FreeAttempts    int
+	MaxFailures     int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutDuration time.Duration
+	Window          time.Duration
+}
+
+var DefaultAccountPolicy = Policy{
+	FreeAttempts:    3,
+	MaxFailures:     10,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutDuration: time.Minute * 30,
+	Window:          time.Hour,
+}
+
+var DefaultIPPolicy = Policy{
+	FreeAttempts:    10,
+	MaxFailures:     100,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutDuration: time.Hour,
+	Window:          time.Hour,
+}
+
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("too many failed attempts, retry after %s", e.RetryAfter.Round(time.Second))
+}
+
+type Guard interface {
+	Check(ctx context.Context, email, ip string) error
+	Fail(ctx context.Context, email, ip string) error
+	Succeed(ctx context.Context, email, ip string) error
+	Unlock(ctx context.Context, email string) error
+}
+
+type guard struct {
+	store         store.LoginAttemptsStore
+	accountPolicy Policy
+	ipPolicy      Policy
+}
+
+func NewGuard(store store.LoginAttemptsStore, accountPolicy, ipPolicy Policy) Guard {
+	return &guard{
+		store:         store,
+		accountPolicy: accountPolicy,
+		ipPolicy:      ipPolicy,
+	}
+}
+
+// Check counts the attempt as failed up front, in the same update that
+// checks the lock, so concurrent guesses can't all pass before the first of
+// them fails. Succeed takes the attempt back. Past MaxFailures only the first
+// attempt after the lockout gets through, the ones running next to it lock
+// the key again.
+func (g *guard) Check(ctx context.Context, email, ip string) error {
+	now := time.Now()
+	for _, key := range g.keys(email, ip) {
+		policy := g.policy(key)
+		before, err := g.store.Attempt(ctx, key, now, now.Add(policy.Window))
+		if err != nil {
+			return err
+		}
+		if now.Before(before.LockedUntil) {
+			return &LockedError{RetryAfter: before.LockedUntil.Sub(now)}
+		}
+		if before.Failures >= policy.MaxFailures && before.LastFailureAt.After(before.LockedUntil) {
+			err = g.store.Lock(ctx, key, now.Add(policy.LockoutDuration))
+			if err != nil {
+				return err
+			}
+			return &LockedError{RetryAfter: policy.LockoutDuration}
+		}
+	}
+	return nil
+}
+
+// Fail locks the keys for the delay their failures call for. The failure
+// itself was counted by Check.
+func (g *guard) Fail(ctx context.Context, email, ip string) error {
+	now := time.Now()
+	for _, key := range g.keys(email, ip) {
+		attempt, err := g.store.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		delay := g.policy(key).delay(attempt)
+		if delay <= 0 {
+			continue
+		}
+		err = g.store.Lock(ctx, key, now.Add(delay))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *guard) Succeed(ctx context.Context, email, ip string) error {
+	err := g.store.Reset(ctx, accountKey(email))
+	if err != nil || ip == "" {
+		return err
+	}
+	return g.store.Release(ctx, ipKey(ip))
+}
+
+func (g *guard) Unlock(ctx context.Context, email string) error {
+	return g.store.Reset(ctx, accountKey(email))
+}
+
+func (g *guard) policy(key string) Policy {
+	if strings.HasPrefix(key, ipKeyPrefix) {
+		return g.ipPolicy
+	}
+	return g.accountPolicy
+}
+
+func (p Policy) delay(attempt *models.LoginAttempt) time.Duration {
+	if attempt.Failures >= p.MaxFailures {
+		return p.LockoutDuration
+	}
+	exceeded := attempt.Failures - p.FreeAttempts
+	if exceeded <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := 1; i < exceeded && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+func (g *guard) keys(email, ip string) []string {
+	keys := []string{accountKey(email)}
+	if ip != "" {
+		keys = append(keys, ipKey(ip))
+	}
+	return keys
+}
+
+const (
+	accountKeyPrefix = "account:"
+	ipKeyPrefix      = "ip:"
+)
+
+func accountKey(email string) string {
+	return accountKeyPrefix + email
+}
+
+func ipKey(ip string) string {
+	return ipKeyPrefix + ip
+}
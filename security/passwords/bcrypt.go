@@ -0,0 +1,38 @@
+package passwords
+
+import "golang.org/x/crypto/bcrypt"
+
+const DefaultBcryptCost = bcrypt.DefaultCost
+
+type bcryptHasher struct {
+	cost int
+}
+
+func NewBcryptHasher(cost int) Hasher {
+	return &bcryptHasher{cost: cost}
+}
+
+func (h *bcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h *bcryptHasher) Verify(hashedPassword, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return ErrMismatchedPassword
+	}
+	return err
+}
+
+func (h *bcryptHasher) Identifies(hashedPassword string) bool {
+	return hasPrefix(hashedPassword, "$2a$", "$2b$", "$2y$")
+}
+
+func (h *bcryptHasher) NeedsRehash(hashedPassword string) bool {
+	cost, err := bcrypt.Cost([]byte(hashedPassword))
+	return err != nil || cost != h.cost
+}
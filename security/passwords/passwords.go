@@ -1,15 +1,72 @@
 package passwords
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrMismatchedPassword = errors.New("password mismatch")
+	ErrUnknownHash        = errors.New("unknown password hash format")
+)
+
+// Hasher hashes passwords into self describing strings. Every hash starts
+// with a versioned prefix, such as "$2a$" or "$argon2id$v=19$", which is how
+// OK finds the hasher that produced it.
+type Hasher interface {
+	Hash(password string) (string, error)
+	Verify(hashedPassword, password string) error
+	Identifies(hashedPassword string) bool
+	NeedsRehash(hashedPassword string) bool
+}
+
+var (
+	current Hasher   = NewArgon2idHasher(DefaultArgon2idParams)
+	known   []Hasher = []Hasher{current, NewBcryptHasher(DefaultBcryptCost)}
+)
+
+// SetHasher changes the hasher used for new passwords. Hashes produced by
+// previously configured hashers can still be verified.
+func SetHasher(h Hasher) {
+	current = h
+	known = append([]Hasher{h}, known...)
+}
 
 func New(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return current.Hash(password)
+}
+
+func OK(hashedPassword, password string) error {
+	h, err := lookup(hashedPassword)
 	if err != nil {
-		return "", err
+		return err
 	}
-	return string(hash), nil
+	return h.Verify(hashedPassword, password)
 }
 
-func OK(hashedPassword, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-}
\ No newline at end of file
+// NeedsRehash reports whether the hash was produced by an outdated
+// algorithm or with outdated parameters.
+func NeedsRehash(hashedPassword string) bool {
+	if !current.Identifies(hashedPassword) {
+		return true
+	}
+	return current.NeedsRehash(hashedPassword)
+}
+
+func lookup(hashedPassword string) (Hasher, error) {
+	for _, h := range known {
+		if h.Identifies(hashedPassword) {
+			return h, nil
+		}
+	}
+	return nil, ErrUnknownHash
+}
+
+func hasPrefix(s string, prefixes ...string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package passwords
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+//go:embed common.txt
+var commonPasswords string
+
+var (
+	ErrPasswordBanned       = errors.New("password is too common")
+	ErrPasswordMatchesEmail = errors.New("password must not match the email")
+)
+
+type Policy struct {
+	MinLength int
+	MaxLength int
+	banned    map[string]struct{}
+}
+
+func NewPolicy(minLength, maxLength int) *Policy {
+	return NewPolicyWithBanned(minLength, maxLength, strings.Split(commonPasswords, "\n"))
+}
+
+func NewPolicyWithBanned(minLength, maxLength int, banned []string) *Policy {
+	p := &Policy{
+		MinLength: minLength,
+		MaxLength: maxLength,
+		banned:    make(map[string]struct{}, len(banned)),
+	}
+	for _, password := range banned {
+		password = strings.ToLower(strings.TrimSpace(password))
+		if password != "" {
+			p.banned[password] = struct{}{}
+		}
+	}
+	return p
+}
+
+func (p *Policy) Validate(password, email string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return fmt.Errorf("password must have at least %d characters", p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return fmt.Errorf("password must have at most %d characters", p.MaxLength)
+	}
+
+	lower := strings.ToLower(password)
+	if _, ok := p.banned[lower]; ok {
+		return ErrPasswordBanned
+	}
+
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email != "" {
+		local := email
+		if at := strings.LastIndex(email, "@"); at > 0 {
+			local = email[:at]
+		}
+		if lower == email || lower == local {
+			return ErrPasswordMatchesEmail
+		}
+	}
+	return nil
+}
@@ -3,19 +3,39 @@ package tokens
 import (
 	"fmt"
 	"github.com/golang-jwt/jwt"
-	"os"
 	"time"
 )
 
-var jwtSecretKey = os.Getenv("JWT_SECRET_KEY")
+var jwtSecretKey string
 
-const defaultExpiration = time.Minute * 60
+// SetSecretKey sets the HMAC key tokens are signed and verified with. It must
+// be called at startup.
+func SetSecretKey(key string) {
+	jwtSecretKey = key
+}
+
+const (
+	defaultExpiration   = time.Minute * 60
+	challengeExpiration = time.Minute * 5
+	challengeAudience   = "mfa"
+)
 
 func New(userID string) (string, error) {
+	return sign(userID, "", defaultExpiration)
+}
+
+// NewChallenge issues a short lived token proving that the password step of
+// a sign in succeeded. It cannot be used as an access token.
+func NewChallenge(userID string) (string, error) {
+	return sign(userID, challengeAudience, challengeExpiration)
+}
+
+func sign(userID, audience string, expiration time.Duration) (string, error) {
 	issuedAt := time.Now()
 
 	claims := jwt.StandardClaims{
-		ExpiresAt: issuedAt.Add(defaultExpiration).Unix(),
+		Audience:  audience,
+		ExpiresAt: issuedAt.Add(expiration).Unix(),
 		Id:        userID,
 		IssuedAt:  issuedAt.Unix(),
 		Issuer:    "workflows",
@@ -43,6 +63,14 @@ func getKey(token *jwt.Token) (interface{}, error) {
 }
 
 func Parse(tokenString string) (*TokenPayload, error) {
+	return parse(tokenString, "")
+}
+
+func ParseChallenge(tokenString string) (*TokenPayload, error) {
+	return parse(tokenString, challengeAudience)
+}
+
+func parse(tokenString, audience string) (*TokenPayload, error) {
 	claims := new(jwt.StandardClaims)
 	token, err := jwt.ParseWithClaims(tokenString, claims, getKey)
 	if err != nil {
@@ -53,6 +81,9 @@ func Parse(tokenString string) (*TokenPayload, error) {
 	if !token.Valid || !ok {
 		return nil, jwt.NewValidationError("invalid token", jwt.ValidationErrorMalformed)
 	}
+	if claims.Audience != audience {
+		return nil, jwt.NewValidationError("invalid token audience", jwt.ValidationErrorAudience)
+	}
 	return &TokenPayload{
 		UserID:    claims.Id,
 		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
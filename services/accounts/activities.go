@@ -0,0 +1,52 @@
+package accounts
+
+import (
+	"context"
+	"go.temporal.io/sdk/activity"
+	"time"
+)
+
+const heartbeatInterval = time.Second * 10
+
+type Activities struct {
+	svc Service
+}
+
+func (a *Activities) RevokeTokens(ctx context.Context, state DeleteAccountState) (DeleteAccountState, error) {
+	return a.svc.RevokeTokens(ctx, state)
+}
+
+func (a *Activities) ListActiveSubscriptions(ctx context.Context, state DeleteAccountState) (DeleteAccountState, error) {
+	return a.svc.ListActiveSubscriptions(ctx, state)
+}
+
+func (a *Activities) CancelSubscription(ctx context.Context, userID, subID string) error {
+	return a.svc.CancelSubscription(ctx, userID, subID)
+}
+
+func (a *Activities) AwaitSubscription(ctx context.Context, subID string) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- a.svc.AwaitSubscription(ctx, subID)
+	}()
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-ticker.C:
+			activity.RecordHeartbeat(ctx, subID)
+		}
+	}
+}
+
+func (a *Activities) SettleBalance(ctx context.Context, state DeleteAccountState) (DeleteAccountState, error) {
+	return a.svc.SettleBalance(ctx, state)
+}
+
+func (a *Activities) Anonymize(ctx context.Context, state DeleteAccountState) (DeleteAccountState, error) {
+	return a.svc.Anonymize(ctx, state)
+}
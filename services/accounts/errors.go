@@ -0,0 +1,9 @@
+package accounts
+
+import "errors"
+
+var (
+	ErrAccountDeleted       = errors.New("account already deleted")
+	ErrInvalidBalancePolicy = errors.New("invalid balance policy")
+	ErrSummaryNotReady      = errors.New("account summary not ready")
+)
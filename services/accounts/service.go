@@ -0,0 +1,324 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-temporal-workflow/db"
+	"go-temporal-workflow/forms"
+	"go-temporal-workflow/logging"
+	"go-temporal-workflow/models"
+	"go-temporal-workflow/services/subscriptions"
+	"go-temporal-workflow/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/temporal"
+	"time"
+)
+
+type Service interface {
+	DeleteAccount(ctx context.Context, userID string) (*forms.DeleteAccountOutput, error)
+	Export(ctx context.Context, userID string) (*forms.AccountExport, error)
+	Summary(ctx context.Context, userID string) (*forms.AccountSummaryOutput, error)
+	RevokeTokens(ctx context.Context, state DeleteAccountState) (DeleteAccountState, error)
+	ListActiveSubscriptions(ctx context.Context, state DeleteAccountState) (DeleteAccountState, error)
+	CancelSubscription(ctx context.Context, userID, subID string) error
+	AwaitSubscription(ctx context.Context, subID string) error
+	SettleBalance(ctx context.Context, state DeleteAccountState) (DeleteAccountState, error)
+	Anonymize(ctx context.Context, state DeleteAccountState) (DeleteAccountState, error)
+}
+
+type service struct {
+	usersStore           store.UsersStore
+	subscriptionsStore   store.SubscriptionsStore
+	transactionsStore    store.TransactionsStore
+	summariesStore       store.AccountSummariesStore
+	transactor           db.Transactor
+	subscriptionsService subscriptions.Service
+	temporalClient       client.Client
+	balancePolicy        string
+}
+
+func NewService(
+	usersStore store.UsersStore,
+	subscriptionsStore store.SubscriptionsStore,
+	transactionsStore store.TransactionsStore,
+	summariesStore store.AccountSummariesStore,
+	transactor db.Transactor,
+	subscriptionsService subscriptions.Service,
+	temporalClient client.Client,
+	balancePolicy string,
+) Service {
+	return &service{
+		usersStore:           usersStore,
+		subscriptionsStore:   subscriptionsStore,
+		transactionsStore:    transactionsStore,
+		summariesStore:       summariesStore,
+		transactor:           transactor,
+		subscriptionsService: subscriptionsService,
+		temporalClient:       temporalClient,
+		balancePolicy:        balancePolicy,
+	}
+}
+
+func (s *service) DeleteAccount(ctx context.Context, userID string) (*forms.DeleteAccountOutput, error) {
+	if s.balancePolicy != BalancePolicyRefund && s.balancePolicy != BalancePolicyForfeit {
+		return nil, ErrInvalidBalancePolicy
+	}
+
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Deleted {
+		return nil, ErrAccountDeleted
+	}
+
+	state := DeleteAccountState{
+		UserID:        user.ID.Hex(),
+		BalancePolicy: s.balancePolicy,
+	}
+
+	options := client.StartWorkflowOptions{
+		ID:                    "delete-account-" + state.UserID,
+		TaskQueue:             TaskQueueName,
+		WorkflowIDReusePolicy: enums.WORKFLOW_ID_REUSE_POLICY_ALLOW_DUPLICATE_FAILED_ONLY,
+	}
+
+	we, err := s.temporalClient.ExecuteWorkflow(ctx, options, DeleteAccountWorkflow, state, &Activities{svc: s})
+	if err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Info("workflow started", "workflow_id", we.GetID(), "run_id", we.GetRunID())
+
+	return &forms.DeleteAccountOutput{WorkflowID: we.GetID(), RunID: we.GetRunID()}, nil
+}
+
+func (s *service) Export(ctx context.Context, userID string) (*forms.AccountExport, error) {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	subs, err := s.subscriptionsStore.GetByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := s.transactionsStore.GetByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &forms.AccountExport{
+		ExportedAt: time.Now(),
+		Profile: &forms.UserOutput{
+			ID:         user.ID.Hex(),
+			Email:      user.Email,
+			Balance:    user.Balance,
+			Role:       user.Role,
+			MFAEnabled: user.MFAEnabled,
+			Suspended:  user.Suspended,
+			CreatedAt:  user.CreatedAt,
+			UpdatedAt:  user.UpdatedAt,
+		},
+		Subscriptions: make([]*forms.SubscriptionOutput, 0, len(subs)),
+		Transactions:  make([]*forms.TransactionOutput, 0, len(transactions)),
+	}
+	for _, sub := range subs {
+		out.Subscriptions = append(out.Subscriptions, &forms.SubscriptionOutput{
+			ID:          sub.ID.Hex(),
+			UserID:      sub.UserID.Hex(),
+			Type:        sub.Type,
+			Price:       sub.Price,
+			Canceled:    sub.Canceled,
+			Activations: sub.Activations,
+			ActivatedAt: sub.ActivatedAt,
+			ExpiresAt:   sub.ExpiresAt,
+			CanceledAt:  sub.CanceledAt,
+		})
+	}
+	for _, transaction := range transactions {
+		t := &forms.TransactionOutput{
+			ID:        transaction.ID.Hex(),
+			Type:      transaction.Type,
+			Amount:    transaction.Amount,
+			Balance:   transaction.Balance,
+			Reason:    transaction.Reason,
+			CreatedAt: transaction.CreatedAt,
+		}
+		if !transaction.SubscriptionID.IsZero() {
+			t.SubscriptionID = transaction.SubscriptionID.Hex()
+		}
+		out.Transactions = append(out.Transactions, t)
+	}
+	return out, nil
+}
+
+// Summary reads the account summary projection, which may lag a little
+// behind the latest writes.
+func (s *service) Summary(ctx context.Context, userID string) (*forms.AccountSummaryOutput, error) {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := s.summariesStore.Get(ctx, id)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrSummaryNotReady
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := &forms.AccountSummaryOutput{
+		UserID:    summary.UserID.Hex(),
+		Balance:   summary.Balance,
+		UpdatedAt: summary.UpdatedAt,
+	}
+	if !summary.SubscriptionID.IsZero() {
+		out.SubscriptionID = summary.SubscriptionID.Hex()
+		out.SubscriptionType = summary.SubscriptionType
+		out.NextChargeAt = &summary.NextChargeAt
+	}
+	return out, nil
+}
+
+func (s *service) RevokeTokens(ctx context.Context, state DeleteAccountState) (DeleteAccountState, error) {
+	var user *models.User
+	err := store.RetryOnConflict(ctx, func() error {
+		var err error
+		user, err = s.getUser(ctx, state.UserID)
+		if err != nil {
+			return err
+		}
+		user.Deleting = true
+		user.RevokedAt = time.Now()
+		user.UpdatedAt = time.Now()
+		return s.usersStore.Update(ctx, user)
+	})
+	if err != nil {
+		return state, err
+	}
+	state.RevokedAt = user.RevokedAt.Unix()
+	return state, nil
+}
+
+func (s *service) ListActiveSubscriptions(ctx context.Context, state DeleteAccountState) (DeleteAccountState, error) {
+	userID, err := primitive.ObjectIDFromHex(state.UserID)
+	if err != nil {
+		return state, err
+	}
+	subs, err := s.subscriptionsStore.GetByUserID(ctx, userID)
+	if err != nil {
+		return state, err
+	}
+	state.Subscriptions = state.Subscriptions[:0]
+	for _, sub := range subs {
+		if !sub.Canceled {
+			state.Subscriptions = append(state.Subscriptions, sub.ID.Hex())
+		}
+	}
+	return state, nil
+}
+
+func (s *service) CancelSubscription(ctx context.Context, userID, subID string) error {
+	err := s.subscriptionsService.Cancel(ctx, &forms.CancelSubscriptionInput{
+		UserID: userID,
+		SubID:  subID,
+	})
+	var notFound *serviceerror.NotFound
+	if errors.As(err, &notFound) {
+		// the workflow has already finished, nothing left to signal
+		return nil
+	}
+	return err
+}
+
+// AwaitSubscription blocks until the subscription workflow is closed. How it
+// closed doesn't matter, only that it won't charge the account anymore.
+func (s *service) AwaitSubscription(ctx context.Context, subID string) error {
+	err := s.temporalClient.GetWorkflow(ctx, subID, "").Get(ctx, nil)
+	var notFound *serviceerror.NotFound
+	var closed *temporal.WorkflowExecutionError
+	if errors.As(err, &notFound) || errors.As(err, &closed) {
+		return nil
+	}
+	return err
+}
+
+// SettleBalance zeroes the balance and records it as a refund or forfeit
+// transaction in one transaction, so a retry never finds a zero balance
+// without its record.
+func (s *service) SettleBalance(ctx context.Context, state DeleteAccountState) (DeleteAccountState, error) {
+	typ := models.TransactionForfeit
+	if state.BalancePolicy == BalancePolicyRefund {
+		typ = models.TransactionRefund
+	}
+
+	var amount float64
+	err := store.RetryOnConflict(ctx, func() error {
+		return s.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+			user, err := s.getUser(ctx, state.UserID)
+			if err != nil {
+				return err
+			}
+			amount = user.Balance
+			if amount <= 0 {
+				return nil
+			}
+			user.Balance = 0
+			user.UpdatedAt = time.Now()
+			err = s.usersStore.Update(ctx, user)
+			if err != nil {
+				return err
+			}
+
+			transaction := models.NewTransaction(user, typ, -amount)
+			transaction.Reason = "account deleted"
+			return s.transactionsStore.Create(ctx, transaction)
+		})
+	})
+	if err != nil {
+		return state, err
+	}
+	if amount > 0 {
+		state.Settled = amount
+	}
+	return state, nil
+}
+
+func (s *service) Anonymize(ctx context.Context, state DeleteAccountState) (DeleteAccountState, error) {
+	var user *models.User
+	err := store.RetryOnConflict(ctx, func() error {
+		var err error
+		user, err = s.getUser(ctx, state.UserID)
+		if err != nil {
+			return err
+		}
+		user.Email = fmt.Sprintf("deleted-%s@deleted.invalid", user.ID.Hex())
+		user.Password = ""
+		user.MFAEnabled = false
+		user.MFASecret = ""
+		user.MFALastStep = 0
+		user.RecoveryCodes = nil
+		user.Deleting = false
+		user.Deleted = true
+		user.DeletedAt = time.Now()
+		user.UpdatedAt = time.Now()
+		return s.usersStore.Update(ctx, user)
+	})
+	if err != nil {
+		return state, err
+	}
+	state.DeletedAt = user.DeletedAt.Unix()
+	return state, nil
+}
+
+func (s *service) getUser(ctx context.Context, id string) (*models.User, error) {
+	userID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.usersStore.Get(ctx, userID)
+}
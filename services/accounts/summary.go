@@ -0,0 +1,124 @@
+package accounts
+
+import (
+	"context"
+	"go-temporal-workflow/db"
+	"go-temporal-workflow/logging"
+	"go-temporal-workflow/models"
+	"go-temporal-workflow/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+// summaryWatcher names the resume token of the projection.
+const summaryWatcher = "account_summaries"
+
+// SummaryProjection keeps the account summaries in step with the users and
+// subscriptions collections. Every change recomputes the summary of the user
+// it touches from the current documents, so replayed or reordered events
+// give the same result.
+type SummaryProjection interface {
+	Run(ctx context.Context) error
+	Rebuild(ctx context.Context) error
+}
+
+type summaryProjection struct {
+	watcher            db.Watcher
+	usersStore         store.UsersStore
+	subscriptionsStore store.SubscriptionsStore
+	summariesStore     store.AccountSummariesStore
+}
+
+func NewSummaryProjection(database *mongo.Database, usersStore store.UsersStore, subscriptionsStore store.SubscriptionsStore, summariesStore store.AccountSummariesStore) SummaryProjection {
+	p := &summaryProjection{
+		usersStore:         usersStore,
+		subscriptionsStore: subscriptionsStore,
+		summariesStore:     summariesStore,
+	}
+	p.watcher = db.NewWatcher(database, summaryWatcher, &db.WatchOptions{
+		Collections: []string{"users", "subscriptions"},
+		Reset:       p.Rebuild,
+	})
+	return p
+}
+
+// Run applies the changes until ctx is done.
+func (p *summaryProjection) Run(ctx context.Context) error {
+	return p.watcher.Watch(ctx, p.apply)
+}
+
+// Rebuild recomputes the summary of every user.
+func (p *summaryProjection) Rebuild(ctx context.Context) error {
+	logging.FromContext(ctx).Info("rebuilding account summaries")
+	count := 0
+	err := p.usersStore.ForEach(ctx, func(user *models.User) error {
+		count++
+		return p.refresh(ctx, user.ID)
+	})
+	if err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("account summaries rebuilt", "users", count)
+	return nil
+}
+
+func (p *summaryProjection) apply(ctx context.Context, event *db.ChangeEvent) error {
+	switch event.Collection {
+	case "users":
+		userID, ok := event.DocumentID.(primitive.ObjectID)
+		if !ok {
+			return nil
+		}
+		return p.refresh(ctx, userID)
+	case "subscriptions":
+		var sub models.Subscription
+		err := event.Decode(&sub)
+		if err == mongo.ErrNoDocuments {
+			// a hard delete carries no user ID, the next change to the
+			// user fixes the summary
+			logging.FromContext(ctx).Info("subscription removed, summary not refreshed", "id", event.DocumentID)
+			return nil
+		}
+		if err != nil {
+			// retrying won't decode it either, skip it rather than stall
+			logging.FromContext(ctx).Error("error on decode subscription, summary not refreshed", "id", event.DocumentID, "err", err)
+			return nil
+		}
+		return p.refresh(ctx, sub.UserID)
+	}
+	return nil
+}
+
+func (p *summaryProjection) refresh(ctx context.Context, userID primitive.ObjectID) error {
+	user, err := p.usersStore.Get(ctx, userID)
+	if err == mongo.ErrNoDocuments {
+		return p.summariesStore.Delete(ctx, userID)
+	}
+	if err != nil {
+		return err
+	}
+	if user.Deleted {
+		return p.summariesStore.Delete(ctx, userID)
+	}
+
+	subs, err := p.subscriptionsStore.GetByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	summary := &models.AccountSummary{
+		UserID:    user.ID,
+		Balance:   user.Balance,
+		UpdatedAt: time.Now(),
+	}
+	for _, sub := range subs {
+		if !sub.Canceled {
+			summary.SubscriptionID = sub.ID
+			summary.SubscriptionType = sub.Type
+			summary.NextChargeAt = sub.ExpiresAt
+			break
+		}
+	}
+	return p.summariesStore.Put(ctx, summary)
+}
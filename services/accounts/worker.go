@@ -0,0 +1,24 @@
+package accounts
+
+import (
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/worker"
+	"time"
+)
+
+const workerStopTimeout = 20 * time.Second
+
+func NewWorker(temporalClient client.Client, svc Service) (worker.Worker, error) {
+	w := worker.New(temporalClient, TaskQueueName, worker.Options{
+		WorkerStopTimeout: workerStopTimeout,
+	})
+
+	w.RegisterWorkflow(DeleteAccountWorkflow)
+	w.RegisterActivity(&Activities{svc: svc})
+
+	err := w.Start()
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
@@ -0,0 +1,102 @@
+package accounts
+
+import (
+	"go-temporal-workflow/logging"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+	"time"
+)
+
+const (
+	TaskQueueName = "AccountsTaskQueue"
+
+	// BalancePolicyRefund only records the balance as a refund transaction,
+	// paying it out is left to whoever processes the refund transactions.
+	BalancePolicyRefund  = "refund"
+	BalancePolicyForfeit = "forfeit"
+)
+
+type DeleteAccountState struct {
+	UserID        string
+	BalancePolicy string
+	Subscriptions []string
+	Settled       float64
+	RevokedAt     int64
+	DeletedAt     int64
+}
+
+func DeleteAccountWorkflow(ctx workflow.Context, state DeleteAccountState, activities *Activities) (DeleteAccountState, error) {
+
+	logger := logging.WorkflowLogger(ctx)
+
+	ao := workflow.ActivityOptions{
+		StartToCloseTimeout: time.Second * 30,
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 5,
+		},
+	}
+
+	ctx = workflow.WithActivityOptions(ctx, ao)
+
+	// tokens are revoked and the user marked as deleting first so no new
+	// subscription can be started while the existing ones are being canceled
+	err := workflow.ExecuteActivity(ctx, activities.RevokeTokens, state).Get(ctx, &state)
+	if err != nil {
+		return state, err
+	}
+
+	err = workflow.ExecuteActivity(ctx, activities.ListActiveSubscriptions, state).Get(ctx, &state)
+	if err != nil {
+		return state, err
+	}
+
+	logger.Info("canceling subscriptions", "user_id", state.UserID, "count", len(state.Subscriptions))
+
+	futures := make([]workflow.Future, 0, len(state.Subscriptions))
+	for _, subID := range state.Subscriptions {
+		futures = append(futures, workflow.ExecuteActivity(ctx, activities.CancelSubscription, state.UserID, subID))
+	}
+	for _, future := range futures {
+		err = future.Get(ctx, nil)
+		if err != nil {
+			return state, err
+		}
+	}
+
+	awaitCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute * 15,
+		HeartbeatTimeout:    time.Second * 30,
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 5,
+		},
+	})
+
+	futures = futures[:0]
+	for _, subID := range state.Subscriptions {
+		futures = append(futures, workflow.ExecuteActivity(awaitCtx, activities.AwaitSubscription, subID))
+	}
+	for _, future := range futures {
+		err = future.Get(ctx, nil)
+		if err != nil {
+			return state, err
+		}
+	}
+
+	logger.Info("subscriptions finished", "user_id", state.UserID)
+
+	err = workflow.ExecuteActivity(ctx, activities.SettleBalance, state).Get(ctx, &state)
+	if err != nil {
+		return state, err
+	}
+
+	logger.Info("balance settled", "user_id", state.UserID, "policy", state.BalancePolicy, "amount", state.Settled)
+
+	err = workflow.ExecuteActivity(ctx, activities.Anonymize, state).Get(ctx, &state)
+	if err != nil {
+		return state, err
+	}
+
+	logger.Info("account deleted", "user_id", state.UserID)
+
+	return state, nil
+}
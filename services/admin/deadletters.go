@@ -0,0 +1,76 @@
+package admin
+
+import (
+	"context"
+	"go-temporal-workflow/forms"
+	"go-temporal-workflow/models"
+	"go-temporal-workflow/services/subscriptions"
+)
+
+const (
+	defaultDeadLetters = 20
+	maxDeadLetters     = 500
+)
+
+// deadLetterQueues are the consumer queues declared with retries.
+var deadLetterQueues = map[string]bool{
+	subscriptions.Queue: true,
+}
+
+func (s *service) PeekDeadLetters(ctx context.Context, in *forms.DeadLettersInput) ([]*forms.DeadLetterOutput, error) {
+	if !deadLetterQueues[in.Queue] {
+		return nil, ErrUnknownQueue
+	}
+	letters, err := s.deadLetters.Peek(in.Queue, deadLettersLimit(in.Limit))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*forms.DeadLetterOutput, 0, len(letters))
+	for _, letter := range letters {
+		out = append(out, &forms.DeadLetterOutput{
+			MessageID:      letter.MessageID,
+			Type:           letter.Type,
+			Version:        letter.Version,
+			CorrelationID:  letter.CorrelationID,
+			Data:           string(letter.Data),
+			Attempts:       letter.Attempts,
+			LastError:      letter.LastError,
+			OriginalQueue:  letter.OriginalQueue,
+			DeadLetteredAt: letter.DeadLetteredAt,
+		})
+	}
+	return out, nil
+}
+
+func (s *service) ReplayDeadLetters(ctx context.Context, in *forms.DeadLettersInput) (*forms.ReplayDeadLettersOutput, error) {
+	if !deadLetterQueues[in.Queue] {
+		return nil, ErrUnknownQueue
+	}
+	if in.Reason == "" {
+		return nil, ErrReasonRequired
+	}
+	replayed, err := s.deadLetters.Replay(in.Queue, deadLettersLimit(in.Limit))
+	if replayed > 0 {
+		auditErr := s.audit(ctx, &in.AdminActionInput, models.AuditReplayDead, map[string]interface{}{
+			"queue":    in.Queue,
+			"replayed": replayed,
+		})
+		if err == nil {
+			err = auditErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &forms.ReplayDeadLettersOutput{Queue: in.Queue, Replayed: replayed}, nil
+}
+
+func deadLettersLimit(limit int) int {
+	if limit < 1 {
+		return defaultDeadLetters
+	}
+	if limit > maxDeadLetters {
+		return maxDeadLetters
+	}
+	return limit
+}
@@ -0,0 +1,15 @@
+package admin
+
+import "errors"
+
+var (
+	ErrReasonRequired     = errors.New("reason is required")
+	ErrInvalidRole        = errors.New("invalid role")
+	ErrInvalidAmount      = errors.New("invalid amount")
+	ErrNegativeBalance    = errors.New("balance cannot be negative")
+	ErrAlreadySuspended   = errors.New("user already suspended")
+	ErrNotSuspended       = errors.New("user not suspended")
+	ErrSelfAction         = errors.New("admins cannot apply this action to themselves")
+	ErrActiveSubscription = errors.New("user has active subscriptions")
+	ErrUnknownQueue       = errors.New("unknown queue")
+)
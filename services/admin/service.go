@@ -0,0 +1,362 @@
+package admin
+
+import (
+	"context"
+	"go-temporal-workflow/bus"
+	"go-temporal-workflow/db"
+	"go-temporal-workflow/forms"
+	"go-temporal-workflow/models"
+	"go-temporal-workflow/security/lockout"
+	"go-temporal-workflow/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type Service interface {
+	ListUsers(ctx context.Context, in *forms.AdminUsersInput) (*forms.AdminUsersOutput, error)
+	GetUser(ctx context.Context, id string) (*forms.AdminUserOutput, error)
+	GetAudit(ctx context.Context, id string) ([]*forms.AuditEntryOutput, error)
+	ChangeRole(ctx context.Context, in *forms.ChangeRoleInput) (*forms.UserOutput, error)
+	Suspend(ctx context.Context, in *forms.AdminActionInput) (*forms.UserOutput, error)
+	Reactivate(ctx context.Context, in *forms.AdminActionInput) (*forms.UserOutput, error)
+	AdjustBalance(ctx context.Context, in *forms.AdjustBalanceInput) (*forms.UserOutput, error)
+	Unlock(ctx context.Context, in *forms.AdminActionInput) error
+	DeleteUser(ctx context.Context, in *forms.AdminActionInput) error
+	PeekDeadLetters(ctx context.Context, in *forms.DeadLettersInput) ([]*forms.DeadLetterOutput, error)
+	ReplayDeadLetters(ctx context.Context, in *forms.DeadLettersInput) (*forms.ReplayDeadLettersOutput, error)
+}
+
+type service struct {
+	usersStore         store.UsersStore
+	subscriptionsStore store.SubscriptionsStore
+	transactionsStore  store.TransactionsStore
+	auditStore         store.AuditStore
+	transactor         db.Transactor
+	guard              lockout.Guard
+	deadLetters        bus.DeadLetters
+}
+
+func NewService(usersStore store.UsersStore, subscriptionsStore store.SubscriptionsStore, transactionsStore store.TransactionsStore, auditStore store.AuditStore, transactor db.Transactor, guard lockout.Guard, deadLetters bus.DeadLetters) Service {
+	return &service{
+		usersStore:         usersStore,
+		subscriptionsStore: subscriptionsStore,
+		transactionsStore:  transactionsStore,
+		auditStore:         auditStore,
+		transactor:         transactor,
+		guard:              guard,
+		deadLetters:        deadLetters,
+	}
+}
+
+func (s *service) ListUsers(ctx context.Context, in *forms.AdminUsersInput) (*forms.AdminUsersOutput, error) {
+	page := in.Page
+	if page < 1 {
+		page = 1
+	}
+	pageSize := in.PageSize
+	if pageSize < 1 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	query := &store.UsersQuery{
+		Email: strings.ToLower(strings.TrimSpace(in.Email)),
+		Skip:  (page - 1) * pageSize,
+		Limit: pageSize,
+	}
+
+	total, err := s.usersStore.Count(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	users, err := s.usersStore.GetAll(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &forms.AdminUsersOutput{
+		Users:    make([]*forms.UserOutput, 0, len(users)),
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}
+	for _, user := range users {
+		out.Users = append(out.Users, newUserOutput(user))
+	}
+	return out, nil
+}
+
+func (s *service) GetUser(ctx context.Context, id string) (*forms.AdminUserOutput, error) {
+	user, err := s.getUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	subs, err := s.subscriptionsStore.GetByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	out := &forms.AdminUserOutput{
+		UserOutput:    newUserOutput(user),
+		Subscriptions: make([]*forms.SubscriptionOutput, 0, len(subs)),
+	}
+	for _, sub := range subs {
+		out.Subscriptions = append(out.Subscriptions, &forms.SubscriptionOutput{
+			ID:          sub.ID.Hex(),
+			UserID:      sub.UserID.Hex(),
+			Type:        sub.Type,
+			Price:       sub.Price,
+			Canceled:    sub.Canceled,
+			Activations: sub.Activations,
+			ActivatedAt: sub.ActivatedAt,
+			ExpiresAt:   sub.ExpiresAt,
+			CanceledAt:  sub.CanceledAt,
+		})
+	}
+	return out, nil
+}
+
+func (s *service) GetAudit(ctx context.Context, id string) ([]*forms.AuditEntryOutput, error) {
+	userID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.auditStore.GetByTargetID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*forms.AuditEntryOutput, 0, len(entries))
+	for _, entry := range entries {
+		out = append(out, &forms.AuditEntryOutput{
+			ID:        entry.ID.Hex(),
+			ActorID:   entry.ActorID.Hex(),
+			Action:    entry.Action,
+			TargetID:  entry.TargetID.Hex(),
+			Reason:    entry.Reason,
+			Data:      entry.Data,
+			CreatedAt: entry.CreatedAt,
+		})
+	}
+	return out, nil
+}
+
+func (s *service) ChangeRole(ctx context.Context, in *forms.ChangeRoleInput) (*forms.UserOutput, error) {
+	if in.Role != models.RoleUser && in.Role != models.RoleAdmin {
+		return nil, ErrInvalidRole
+	}
+	if in.ActorID == in.UserID {
+		return nil, ErrSelfAction
+	}
+	var user *models.User
+	err := store.RetryOnConflict(ctx, func() error {
+		var err error
+		user, err = s.getUser(ctx, in.UserID)
+		if err != nil {
+			return err
+		}
+		previous := user.Role
+		user.Role = in.Role
+		user.UpdatedAt = time.Now()
+		return s.audited(ctx, &in.AdminActionInput, models.AuditChangeRole, map[string]interface{}{
+			"from": previous,
+			"to":   user.Role,
+		}, func(ctx context.Context) error {
+			return s.usersStore.Update(ctx, user)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newUserOutput(user), nil
+}
+
+func (s *service) Suspend(ctx context.Context, in *forms.AdminActionInput) (*forms.UserOutput, error) {
+	if in.ActorID == in.UserID {
+		return nil, ErrSelfAction
+	}
+	var user *models.User
+	err := store.RetryOnConflict(ctx, func() error {
+		var err error
+		user, err = s.getUser(ctx, in.UserID)
+		if err != nil {
+			return err
+		}
+		if user.Suspended {
+			return ErrAlreadySuspended
+		}
+		user.Suspended = true
+		user.SuspendedAt = time.Now()
+		user.UpdatedAt = time.Now()
+		return s.audited(ctx, in, models.AuditSuspendUser, nil, func(ctx context.Context) error {
+			return s.usersStore.Update(ctx, user)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newUserOutput(user), nil
+}
+
+func (s *service) Reactivate(ctx context.Context, in *forms.AdminActionInput) (*forms.UserOutput, error) {
+	var user *models.User
+	err := store.RetryOnConflict(ctx, func() error {
+		var err error
+		user, err = s.getUser(ctx, in.UserID)
+		if err != nil {
+			return err
+		}
+		if !user.Suspended {
+			return ErrNotSuspended
+		}
+		user.Suspended = false
+		user.SuspendedAt = time.Time{}
+		user.UpdatedAt = time.Now()
+		return s.audited(ctx, in, models.AuditReactivate, nil, func(ctx context.Context) error {
+			return s.usersStore.Update(ctx, user)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newUserOutput(user), nil
+}
+
+func (s *service) AdjustBalance(ctx context.Context, in *forms.AdjustBalanceInput) (*forms.UserOutput, error) {
+	if strings.TrimSpace(in.Reason) == "" {
+		return nil, ErrReasonRequired
+	}
+	if in.Amount == 0 {
+		return nil, ErrInvalidAmount
+	}
+	var user *models.User
+	err := store.RetryOnConflict(ctx, func() error {
+		var err error
+		user, err = s.getUser(ctx, in.UserID)
+		if err != nil {
+			return err
+		}
+		previous := user.Balance
+		if previous+in.Amount < 0 {
+			return ErrNegativeBalance
+		}
+		user.Balance += in.Amount
+		user.UpdatedAt = time.Now()
+		return s.audited(ctx, &in.AdminActionInput, models.AuditAdjustBalance, map[string]interface{}{
+			"amount": in.Amount,
+			"from":   previous,
+			"to":     user.Balance,
+		}, func(ctx context.Context) error {
+			err := s.usersStore.Update(ctx, user)
+			if err != nil {
+				return err
+			}
+			transaction := models.NewTransaction(user, models.TransactionAdjustment, in.Amount)
+			transaction.Reason = in.Reason
+			return s.transactionsStore.Create(ctx, transaction)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newUserOutput(user), nil
+}
+
+func (s *service) Unlock(ctx context.Context, in *forms.AdminActionInput) error {
+	user, err := s.getUser(ctx, in.UserID)
+	if err != nil {
+		return err
+	}
+	return s.audited(ctx, in, models.AuditUnlockUser, nil, func(ctx context.Context) error {
+		return s.guard.Unlock(ctx, user.Email)
+	})
+}
+
+func (s *service) DeleteUser(ctx context.Context, in *forms.AdminActionInput) error {
+	if in.ActorID == in.UserID {
+		return ErrSelfAction
+	}
+	user, err := s.getUser(ctx, in.UserID)
+	if err != nil {
+		return err
+	}
+	subs, err := s.subscriptionsStore.GetByUserID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, sub := range subs {
+		if !sub.Canceled {
+			return ErrActiveSubscription
+		}
+	}
+	return s.audited(ctx, in, models.AuditDeleteUser, map[string]interface{}{
+		"email":   user.Email,
+		"balance": user.Balance,
+	}, func(ctx context.Context) error {
+		return s.usersStore.Delete(ctx, user.ID)
+	})
+}
+
+// audited runs fn in a transaction with the audit entry of the action, so an
+// admin change is never stored without its entry. The entry is written
+// first.
+func (s *service) audited(ctx context.Context, in *forms.AdminActionInput, action string, data map[string]interface{}, fn func(ctx context.Context) error) error {
+	return s.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		err := s.audit(ctx, in, action, data)
+		if err != nil {
+			return err
+		}
+		return fn(ctx)
+	})
+}
+
+func (s *service) audit(ctx context.Context, in *forms.AdminActionInput, action string, data map[string]interface{}) error {
+	actorID, err := primitive.ObjectIDFromHex(in.ActorID)
+	if err != nil {
+		return err
+	}
+	targetID := primitive.NilObjectID
+	if in.UserID != "" {
+		targetID, err = primitive.ObjectIDFromHex(in.UserID)
+		if err != nil {
+			return err
+		}
+	}
+	return s.auditStore.Create(ctx, &models.AuditEntry{
+		ID:        primitive.NewObjectID(),
+		ActorID:   actorID,
+		Action:    action,
+		TargetID:  targetID,
+		Reason:    in.Reason,
+		Data:      data,
+		CreatedAt: time.Now(),
+	})
+}
+
+func (s *service) getUser(ctx context.Context, id string) (*models.User, error) {
+	userID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.usersStore.Get(ctx, userID)
+}
+
+func newUserOutput(user *models.User) *forms.UserOutput {
+	return &forms.UserOutput{
+		ID:         user.ID.Hex(),
+		Email:      user.Email,
+		Password:   user.Password,
+		Balance:    user.Balance,
+		Role:       user.Role,
+		MFAEnabled: user.MFAEnabled,
+		Suspended:  user.Suspended,
+		CreatedAt:  user.CreatedAt,
+		UpdatedAt:  user.UpdatedAt,
+	}
+}
@@ -0,0 +1,5 @@
+package commands
+
+import "errors"
+
+var ErrCommandNotFound = errors.New("command not found")
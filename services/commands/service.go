@@ -0,0 +1,80 @@
+package commands
+
+import (
+	"context"
+	"go-temporal-workflow/forms"
+	"go-temporal-workflow/models"
+	"go-temporal-workflow/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+type Service interface {
+	Create(ctx context.Context, id, typ, userID string) error
+	Get(ctx context.Context, userID, id string) (*forms.CommandOutput, error)
+	Succeed(ctx context.Context, id, workflowID string) error
+	Fail(ctx context.Context, id string, cause error) error
+	// Retrying records the error of a failed attempt that will be retried,
+	// the command stays pending.
+	Retrying(ctx context.Context, id string, cause error) error
+}
+
+type service struct {
+	commandsStore store.CommandsStore
+}
+
+func NewService(commandsStore store.CommandsStore) Service {
+	return &service{commandsStore: commandsStore}
+}
+
+func (s *service) Create(ctx context.Context, id, typ, userID string) error {
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return s.commandsStore.Create(ctx, &models.Command{
+		ID:        id,
+		Type:      typ,
+		UserID:    uid,
+		Status:    models.CommandPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+}
+
+// Get returns the command only to the user who issued it.
+func (s *service) Get(ctx context.Context, userID, id string) (*forms.CommandOutput, error) {
+	command, err := s.commandsStore.Get(ctx, id)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrCommandNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if command.UserID.Hex() != userID {
+		return nil, ErrCommandNotFound
+	}
+	return &forms.CommandOutput{
+		ID:         command.ID,
+		Type:       command.Type,
+		Status:     command.Status,
+		WorkflowID: command.WorkflowID,
+		Error:      command.Error,
+		CreatedAt:  command.CreatedAt,
+		UpdatedAt:  command.UpdatedAt,
+	}, nil
+}
+
+func (s *service) Succeed(ctx context.Context, id, workflowID string) error {
+	return s.commandsStore.SetStatus(ctx, id, models.CommandSucceeded, workflowID, "")
+}
+
+func (s *service) Fail(ctx context.Context, id string, cause error) error {
+	return s.commandsStore.SetStatus(ctx, id, models.CommandFailed, "", cause.Error())
+}
+
+func (s *service) Retrying(ctx context.Context, id string, cause error) error {
+	return s.commandsStore.SetStatus(ctx, id, models.CommandPending, "", cause.Error())
+}
@@ -0,0 +1,41 @@
+package subscriptions
+
+import (
+	"go-temporal-workflow/bus"
+	"go-temporal-workflow/bus/amqpbus"
+	"go-temporal-workflow/bus/memory"
+	"go-temporal-workflow/rmq"
+	"time"
+)
+
+// AMQPOptions retries the subscription commands through retry queues. The
+// api and the worker bind the queue with the same options, RabbitMQ refuses
+// to declare a queue again with other arguments.
+func AMQPOptions() *amqpbus.Options {
+	opts := amqpbus.DefaultOptions()
+	opts.Retry = &rmq.RetryOptions{
+		MaxAttempts: 5,
+		Delays:      []time.Duration{5 * time.Second, 30 * time.Second, 2 * time.Minute},
+	}
+	return opts
+}
+
+func MemoryOptions() *memory.Options {
+	return &memory.Options{
+		MaxAttempts: 5,
+		RetryDelay:  5 * time.Second,
+	}
+}
+
+func Bind(b bus.Bus) error {
+	return b.Bind(Exchange, "", Queue)
+}
+
+// Listen consumes the subscription commands, in order per user, until the
+// bus is stopped.
+func Listen(consumer bus.Consumer) error {
+	return consumer.Listen(Queue, &bus.ListenOptions{
+		Workers: 8,
+		KeyFunc: MessageKey,
+	})
+}
@@ -2,4 +2,11 @@ package subscriptions
 
 import "errors"
 
-var ErrInsufficientFunds = errors.New("insufficient funds")
+var (
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrAccountDeleted    = errors.New("account deleted")
+	ErrAccountDeleting   = errors.New("account being deleted")
+	ErrAlreadyActivated  = errors.New("subscription already activated")
+	ErrCannotCancel      = errors.New("cannot cancel subscription")
+	ErrNotFound          = errors.New("subscription not found")
+)
@@ -3,36 +3,157 @@ package subscriptions
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"go-temporal-workflow/bus"
 	"go-temporal-workflow/forms"
-	"go-temporal-workflow/rmq"
+	"go-temporal-workflow/logging"
+	"go-temporal-workflow/outbox"
+	"go-temporal-workflow/services/commands"
+	"go-temporal-workflow/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.temporal.io/api/serviceerror"
 )
 
 type subscriptionsHandlers struct {
-	svc Service
+	svc       Service
+	commands  commands.Service
+	requester bus.Requester
 }
 
-func NewHandler(svc Service, consumer rmq.Consumer) {
-	handler := &subscriptionsHandlers{svc: svc}
+// consumerName identifies the handlers in the inbox.
+const consumerName = "subscriptions"
 
-	consumer.HandleFunc(forms.SubscribeInput{}, handler.HandleSubscribe)
-	consumer.HandleFunc(forms.CancelSubscriptionInput{}, handler.HandleCancel)
+func NewHandler(svc Service, commandsService commands.Service, consumer bus.Handlers, requester bus.Requester, inbox store.InboxStore) {
+	handler := &subscriptionsHandlers{svc: svc, commands: commandsService, requester: requester}
+
+	consumer.HandleFunc(SubscribeMessage, SubscribeMessageVersion, outbox.DedupeReply(inbox, consumerName, handler.HandleSubscribe, handler.ReplySubscribed))
+	consumer.HandleFunc(CancelMessage, CancelMessageVersion, outbox.Dedupe(inbox, consumerName, handler.HandleCancel))
+	consumer.HandleFunc(CancelWorkflowMessage, CancelWorkflowMessageVersion, handler.HandleCancelWorkflow)
 }
 
-func (h *subscriptionsHandlers) HandleSubscribe(data []byte) error {
+func (h *subscriptionsHandlers) HandleSubscribe(msg *bus.Message) error {
 	var in forms.SubscribeInput
-	err := json.Unmarshal(data, &in)
+	err := json.Unmarshal(msg.Data, &in)
+	if err != nil {
+		return bus.Permanent(err)
+	}
+	in.CommandID = msg.ID
+	workflowID, err := h.svc.Subscribe(messageContext(msg), &in)
+	err = permanent(err)
+	h.track(msg, workflowID, err)
+
+	// transient errors are retried, the requester only hears about the
+	// final outcome
+	if err == nil || errors.Is(err, bus.ErrPermanent) {
+		reply := forms.SubscribeReply{WorkflowID: workflowID}
+		if err != nil {
+			reply.Error = err.Error()
+		}
+		h.reply(msg, reply)
+	}
+	return err
+}
+
+// ReplySubscribed answers a subscribe handled before with the outcome stored
+// in its command.
+func (h *subscriptionsHandlers) ReplySubscribed(msg *bus.Message) error {
+	var in forms.SubscribeInput
+	err := json.Unmarshal(msg.Data, &in)
+	if err != nil {
+		return bus.Permanent(err)
+	}
+	command, err := h.commands.Get(messageContext(msg), in.UserID, msg.ID)
 	if err != nil {
 		return err
 	}
-	return h.svc.Subscribe(context.Background(), &in)
+	h.reply(msg, forms.SubscribeReply{WorkflowID: command.WorkflowID, Error: command.Error})
+	return nil
+}
+
+func (h *subscriptionsHandlers) reply(msg *bus.Message, reply forms.SubscribeReply) {
+	err := h.requester.Reply(msg, reply)
+	if err != nil {
+		logging.FromContext(messageContext(msg)).Error("error on reply subscribe", "message_id", msg.ID, "err", err)
+	}
 }
 
-func (h *subscriptionsHandlers) HandleCancel(data []byte) error {
+func (h *subscriptionsHandlers) HandleCancel(msg *bus.Message) error {
 	var in forms.CancelSubscriptionInput
-	err := json.Unmarshal(data, &in)
+	err := json.Unmarshal(msg.Data, &in)
 	if err != nil {
-		return err
+		return bus.Permanent(err)
 	}
-	return h.svc.Cancel(context.Background(), &in)
+	err = permanent(h.svc.Cancel(messageContext(msg), &in))
+	h.track(msg, in.SubID, err)
+	return err
 }
 
+// track updates the command carried by msg with the outcome of handling it.
+func (h *subscriptionsHandlers) track(msg *bus.Message, workflowID string, err error) {
+	ctx := messageContext(msg)
+	var trackErr error
+	switch {
+	case err == nil:
+		trackErr = h.commands.Succeed(ctx, msg.ID, workflowID)
+	case errors.Is(err, bus.ErrPermanent):
+		trackErr = h.commands.Fail(ctx, msg.ID, err)
+	default:
+		trackErr = h.commands.Retrying(ctx, msg.ID, err)
+	}
+	if trackErr != nil {
+		logging.FromContext(ctx).Error("error on track command", "message_id", msg.ID, "err", trackErr)
+	}
+}
+
+// HandleCancelWorkflow needs no dedupe, signaling a canceled workflow again
+// has no effect.
+func (h *subscriptionsHandlers) HandleCancelWorkflow(msg *bus.Message) error {
+	var in forms.CancelWorkflowInput
+	err := json.Unmarshal(msg.Data, &in)
+	if err != nil {
+		return bus.Permanent(err)
+	}
+	err = h.svc.SignalCancel(messageContext(msg), &in)
+	var notFound *serviceerror.NotFound
+	if errors.As(err, &notFound) {
+		// the workflow already finished
+		return nil
+	}
+	return err
+}
+
+// messageContext carries the request ID of msg, so the logs of the service
+// and of the workflows it starts can be tied to the HTTP request.
+func messageContext(msg *bus.Message) context.Context {
+	return logging.WithRequestID(context.Background(), msg.RequestID)
+}
+
+// MessageKey orders the subscription commands per user, so a cancel is never
+// handled before the subscribe that came first.
+func MessageKey(msg *bus.Message) string {
+	var in struct {
+		UserID string `json:"user_id"`
+	}
+	err := json.Unmarshal(msg.Data, &in)
+	if err != nil {
+		return ""
+	}
+	return in.UserID
+}
+
+// permanent marks the errors that won't change on retry so the consumer
+// dead-letters the message instead of retrying it.
+func permanent(err error) error {
+	switch {
+	case errors.Is(err, ErrAlreadyActivated),
+		errors.Is(err, ErrInsufficientFunds),
+		errors.Is(err, ErrAccountDeleted),
+		errors.Is(err, ErrAccountDeleting),
+		errors.Is(err, ErrCannotCancel),
+		errors.Is(err, primitive.ErrInvalidHex),
+		errors.Is(err, mongo.ErrNoDocuments):
+		return bus.Permanent(err)
+	}
+	return err
+}
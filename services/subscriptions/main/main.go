@@ -3,73 +3,142 @@ package main
 import (
 	"context"
 	"flag"
-	"github.com/streadway/amqp"
-	"go.temporal.io/sdk/client"
-	"log"
-	"time"
+	"go-temporal-workflow/bus"
+	"go-temporal-workflow/bus/amqpbus"
+	"go-temporal-workflow/config"
 	"go-temporal-workflow/db"
+	"go-temporal-workflow/lifecycle"
+	"go-temporal-workflow/logging"
+	"go-temporal-workflow/outbox"
 	"go-temporal-workflow/rmq"
+	"go-temporal-workflow/services/accounts"
+	"go-temporal-workflow/services/commands"
 	"go-temporal-workflow/services/subscriptions"
 	"go-temporal-workflow/store"
+	"go-temporal-workflow/temporalclient"
+	"go-temporal-workflow/utils"
+	"log"
+	"os"
+	"time"
 )
 
-func init() {
-	db.LoadConfigFromFlags(flag.CommandLine)
-	rmq.LoadConfigFromFlags(flag.CommandLine)
-	flag.Parse()
-}
-
 func main() {
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:], utils.GetEnvFilePath())
+	if err != nil {
+		log.Panicln(err)
+	}
+	logger := cfg.Log.Logger()
+	logging.SetDefault(logger)
+	logging.RedirectStdLog(logger)
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	dbConn := db.New(ctx, db.NewConfig())
-	err := dbConn.Ping(ctx)
+	dbConn, err := db.New(ctx, db.NewConfig(cfg.MongoDB.ConnectionOptions()))
 	if err != nil {
 		log.Panicln(err)
 	}
-	defer dbConn.Close(ctx)
-	log.Println("mongodb connected!")
-
-	rmqClient := rmq.NewClient(rmq.NewConfig())
-	defer rmqClient.Close()
-	log.Println("rabbitmq connected!")
-
-	err = rmqClient.ExchangeDeclare(&rmq.ExchangeOptions{
-		Name:    "subscription",
-		Kind:    amqp.ExchangeDirect,
-		Durable: true,
-	})
+	err = dbConn.Ping(ctx)
 	if err != nil {
 		log.Panicln(err)
 	}
+	log.Println("mongodb connected!")
 
-	err = rmqClient.QueueDeclare(&rmq.QueueOptions{
-		Name:    "subscriptions",
-		Durable: true,
-		BindOptions: &rmq.QueueBindOptions{
-			ExchangeName: "subscription",
-		},
-	})
+	// with the memory transport the api consumes the subscription commands
+	// and relays the outbox, the worker only runs the temporal workers
+	var messageBus bus.Bus
+	if cfg.Bus.Transport == config.TransportAMQP {
+		rmqClient, err := rmq.NewClient(rmq.NewConfig(cfg.RabbitMQ.ConnectionOptions()), rmq.DefaultClientOptions())
+		if err != nil {
+			log.Panicln(err)
+		}
+		log.Println("rabbitmq connected!")
+		messageBus = amqpbus.New(rmqClient, subscriptions.AMQPOptions())
+
+		err = subscriptions.Bind(messageBus)
+		if err != nil {
+			log.Panicln(err)
+		}
+	}
 
-	temporalClient, err := client.NewClient(client.Options{})
+	temporalClient, err := temporalclient.New(ctx, temporalclient.NewConfig(cfg.Temporal.ConnectionOptions()))
 	if err != nil {
 		log.Panicln(err)
 	}
-	defer temporalClient.Close()
-
-	consumer := rmqClient.AsConsumer()
 
 	usersStore := store.NewUsersStore(dbConn.DB())
 	subscriptionsStore := store.NewSubscriptionsStore(dbConn.DB())
-	subscriptionsService := subscriptions.NewService(usersStore, subscriptionsStore, temporalClient)
-	subscriptions.NewHandler(subscriptionsService, consumer)
+	transactionsStore := store.NewTransactionsStore(dbConn.DB())
+	outboxStore := store.NewOutboxStore(dbConn.DB())
+	messageOutbox := outbox.New(outboxStore, dbConn)
+	inboxStore := store.NewInboxStore(dbConn.DB())
 
-	go subscriptions.NewWorker(temporalClient, subscriptionsService)
+	subscriptionsService := subscriptions.NewService(usersStore, subscriptionsStore, transactionsStore, store.NewSubscriptionEventsStore(dbConn.DB()), dbConn, messageOutbox, temporalClient)
+	commandsService := commands.NewService(store.NewCommandsStore(dbConn.DB()))
+	if messageBus != nil {
+		subscriptions.NewHandler(subscriptionsService, commandsService, messageBus, messageBus, inboxStore)
+	}
 
-	err = consumer.Listen(&rmq.ConsumerOptions{
-		QueueName: "subscriptions",
+	summariesStore := store.NewAccountSummariesStore(dbConn.DB())
+	accountsService := accounts.NewService(usersStore, subscriptionsStore, transactionsStore, summariesStore, dbConn, subscriptionsService, temporalClient, cfg.API.BalancePolicy)
+	summaries := accounts.NewSummaryProjection(dbConn.DB(), usersStore, subscriptionsStore, summariesStore)
+
+	subscriptionsWorker, err := subscriptions.NewWorker(temporalClient, subscriptionsService)
+	if err != nil {
+		log.Panicln(err)
+	}
+	accountsWorker, err := accounts.NewWorker(temporalClient, accountsService)
+	if err != nil {
+		log.Panicln(err)
+	}
+
+	// stop hooks run in order: stop consuming and drain the handlers, let
+	// running activities finish, then close the clients
+	lc := lifecycle.NewManager(cfg.ShutdownTimeout)
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	if messageBus != nil {
+		relay := outbox.NewRelay(outboxStore, messageBus, outbox.DefaultRelayOptions())
+		lc.Go("consumer", func() error {
+			return subscriptions.Listen(messageBus)
+		})
+		lc.Go("outbox relay", func() error {
+			return relay.Run(relayCtx)
+		})
+		lc.OnStop("consumer", messageBus.Stop)
+	}
+	projectionCtx, stopProjection := context.WithCancel(context.Background())
+	lc.Go("account summaries", func() error {
+		return summaries.Run(projectionCtx)
+	})
+	lc.OnStop("subscriptions worker", lifecycle.Func(func() error {
+		subscriptionsWorker.Stop()
+		return nil
+	}))
+	lc.OnStop("accounts worker", lifecycle.Func(func() error {
+		accountsWorker.Stop()
+		return nil
+	}))
+	lc.OnStop("outbox relay", func(ctx context.Context) error {
+		stopRelay()
+		return nil
 	})
+	lc.OnStop("account summaries", func(ctx context.Context) error {
+		stopProjection()
+		return nil
+	})
+	lc.OnStop("temporal", lifecycle.Func(func() error {
+		temporalClient.Close()
+		return nil
+	}))
+	if messageBus != nil {
+		lc.OnStop("bus", lifecycle.Func(messageBus.Close))
+	}
+	lc.OnStop("mongodb", func(ctx context.Context) error {
+		dbConn.Close(ctx)
+		return nil
+	})
+
+	err = lc.Wait()
 	if err != nil {
 		log.Panicln(err)
 	}
@@ -0,0 +1,37 @@
+package subscriptions
+
+import (
+	"go-temporal-workflow/bus"
+	"go-temporal-workflow/forms"
+)
+
+// Exchange is where the subscription commands are published and Queue where
+// the subscriptions worker consumes them.
+const (
+	Exchange = "subscription"
+	Queue    = "subscriptions"
+)
+
+// Names and versions of the messages consumed by the subscriptions worker.
+// They are part of the wire format and must not change.
+const (
+	SubscribeMessage        = "subscriptions.subscribe"
+	SubscribeMessageVersion = 1
+	CancelMessage           = "subscriptions.cancel"
+	CancelMessageVersion    = 1
+	// SubscribeReplyMessage answers subscribe messages published with
+	// reply-to set.
+	SubscribeReplyMessage        = "subscriptions.subscribe_reply"
+	SubscribeReplyMessageVersion = 1
+	// CancelWorkflowMessage is published by Cancel through the outbox and
+	// signals the workflow once the cancellation is stored.
+	CancelWorkflowMessage        = "subscriptions.cancel_workflow"
+	CancelWorkflowMessageVersion = 1
+)
+
+func init() {
+	bus.RegisterType(SubscribeMessage, SubscribeMessageVersion, forms.SubscribeInput{})
+	bus.RegisterType(CancelMessage, CancelMessageVersion, forms.CancelSubscriptionInput{})
+	bus.RegisterType(SubscribeReplyMessage, SubscribeReplyMessageVersion, forms.SubscribeReply{})
+	bus.RegisterType(CancelWorkflowMessage, CancelWorkflowMessageVersion, forms.CancelWorkflowInput{})
+}
@@ -2,80 +2,118 @@ package subscriptions
 
 import (
 	"context"
+	"crypto/sha256"
 	"errors"
+	"go-temporal-workflow/bus"
+	"go-temporal-workflow/db"
 	"go-temporal-workflow/forms"
+	"go-temporal-workflow/logging"
 	"go-temporal-workflow/models"
+	"go-temporal-workflow/outbox"
 	"go-temporal-workflow/store"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/serviceerror"
 	"go.temporal.io/sdk/client"
-	"log"
 	"time"
 )
 
 type Service interface {
-	Subscribe(ctx context.Context, in *forms.SubscribeInput) error
+	Subscribe(ctx context.Context, in *forms.SubscribeInput) (string, error)
 	Charge(ctx context.Context, state SubscriptionState) (SubscriptionState, error)
 	GetWorkflow(ctx context.Context, id string) (*forms.SubscriptionOutput, error)
 	Cancel(ctx context.Context, in *forms.CancelSubscriptionInput) error
+	SignalCancel(ctx context.Context, in *forms.CancelWorkflowInput) error
 	Delete(ctx context.Context, state SubscriptionState) (SubscriptionState, error)
+	History(ctx context.Context, userID, id string) ([]*forms.SubscriptionEventOutput, error)
 }
 
 type service struct {
 	usersStore         store.UsersStore
 	subscriptionsStore store.SubscriptionsStore
+	transactionsStore  store.TransactionsStore
+	eventsStore        store.SubscriptionEventsStore
+	transactor         db.Transactor
+	outbox             outbox.Outbox
 	temporalClient     client.Client
 }
 
-func NewService(usersStore store.UsersStore, subscriptionsStore store.SubscriptionsStore, temporalClient client.Client) Service {
+func NewService(usersStore store.UsersStore, subscriptionsStore store.SubscriptionsStore, transactionsStore store.TransactionsStore, eventsStore store.SubscriptionEventsStore, transactor db.Transactor, outbox outbox.Outbox, temporalClient client.Client) Service {
 	return &service{
 		usersStore:         usersStore,
 		subscriptionsStore: subscriptionsStore,
+		transactionsStore:  transactionsStore,
+		eventsStore:        eventsStore,
+		transactor:         transactor,
+		outbox:             outbox,
 		temporalClient:     temporalClient,
 	}
 }
 
-func (s *service) Subscribe(ctx context.Context, in *forms.SubscribeInput) error {
+func (s *service) Subscribe(ctx context.Context, in *forms.SubscribeInput) (string, error) {
 	userID, err := primitive.ObjectIDFromHex(in.UserID)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	user, err := s.usersStore.Get(ctx, userID)
 	if err != nil {
-		return err
+		return "", err
+	}
+	if user.Deleted {
+		return "", ErrAccountDeleted
+	}
+	if user.Deleting {
+		// subscribes queued before the deletion started
+		return "", ErrAccountDeleting
 	}
 
 	subs, err := s.subscriptionsStore.GetByUserID(ctx, user.ID)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	log.Printf("current subscriptions: %d\n", len(subs))
+	logger := logging.FromContext(ctx).With("user_id", in.UserID)
+	logger.Debug("current subscriptions", "count", len(subs))
 
+	id := subscriptionID(in.CommandID)
 	for index := range subs {
+		if subs[index].ID == id {
+			// a redelivered subscribe that already went through
+			return id.Hex(), nil
+		}
 		if !subs[index].Canceled {
-			log.Printf("subscription already activated: %s", subs[index].ID.Hex())
-			return errors.New("subscription already activated")
+			logger.Info("subscription already activated", "subscription_id", subs[index].ID.Hex())
+			return "", ErrAlreadyActivated
 		}
 	}
 
-	id := primitive.NewObjectID()
-
 	state := NewDefaultSubscriptionState(id, user)
 
 	options := client.StartWorkflowOptions{
-		ID:                 id.Hex(),
-		TaskQueue:          TaskQueueName,
-		WorkflowRunTimeout: time.Minute * 10,
+		ID:                                       id.Hex(),
+		TaskQueue:                                TaskQueueName,
+		WorkflowRunTimeout:                       time.Minute * 10,
+		WorkflowIDReusePolicy:                    enums.WORKFLOW_ID_REUSE_POLICY_REJECT_DUPLICATE,
+		WorkflowExecutionErrorWhenAlreadyStarted: true,
 	}
 
+	var runID string
+	var started *serviceerror.WorkflowExecutionAlreadyStarted
 	we, err := s.temporalClient.ExecuteWorkflow(ctx, options, SubscriptionWorkflow, state, &Activities{svc: s})
-	if err != nil {
-		return err
+	switch {
+	case errors.As(err, &started):
+		// an earlier attempt started the workflow and failed after it
+		runID = started.RunId
+		logger.Info("workflow already started", "workflow_id", id.Hex(), "run_id", runID)
+	case err != nil:
+		return "", err
+	default:
+		runID = we.GetRunID()
+		logger.Info("workflow started", "workflow_id", we.GetID(), "run_id", runID)
 	}
 
-	log.Printf("workflow started: ID=%s, RunID=%s\n", we.GetID(), we.GetRunID())
-
 	m := &models.Subscription{
 		ID:          id,
 		UserID:      userID,
@@ -86,46 +124,109 @@ func (s *service) Subscribe(ctx context.Context, in *forms.SubscribeInput) error
 		ExpiresAt:   time.Unix(state.ExpiresAt, 0),
 	}
 
-	return s.subscriptionsStore.Create(ctx, m)
-}
-
-func (s *service) Charge(ctx context.Context, state SubscriptionState) (SubscriptionState, error) {
-	userID, err := primitive.ObjectIDFromHex(state.UserID)
-	if err != nil {
-		return state, err
-	}
+	event := models.NewSubscriptionEvent(m, models.SubscriptionCreated, in.UserID)
+	event.Amount = m.Price
+	event.RunID = runID
 
-	user, err := s.usersStore.Get(ctx, userID)
-	if err != nil {
-		return state, err
+	err = s.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		err := s.subscriptionsStore.Create(ctx, m)
+		if err != nil {
+			return err
+		}
+		return s.eventsStore.Create(ctx, event)
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return id.Hex(), nil
 	}
-
-	subID, _ := primitive.ObjectIDFromHex(state.ID)
-
-	subscription, err := s.subscriptionsStore.Get(ctx, subID)
 	if err != nil {
-		return state, err
+		return "", err
 	}
+	return id.Hex(), nil
+}
 
-	if user.Balance < subscription.Price {
-		log.Printf("insufficient funds: UserID=%s, Balance=%.2f, SubscriptionID=%s\n", state.UserID, user.Balance, subscription.ID.Hex())
-		return state, errors.New("insufficient funds")
+// subscriptionID derives the subscription and workflow ID from the command,
+// so a redelivered subscribe starts the same workflow instead of a second
+// one charging the user again.
+func subscriptionID(commandID string) primitive.ObjectID {
+	if commandID == "" {
+		return primitive.NewObjectID()
 	}
+	sum := sha256.Sum256([]byte(commandID))
+	var id primitive.ObjectID
+	copy(id[:], sum[:])
+	return id
+}
 
-	user.Balance -= subscription.Price
-	user.UpdatedAt = time.Now()
-
-	err = s.usersStore.Update(ctx, user)
+// Charge debits the balance, records the transaction and renews the
+// subscription in one transaction.
+func (s *service) Charge(ctx context.Context, state SubscriptionState) (SubscriptionState, error) {
+	userID, err := primitive.ObjectIDFromHex(state.UserID)
 	if err != nil {
 		return state, err
 	}
 
-	subscription.Activations++
-	activatedAt := time.Now()
-	subscription.ActivatedAt = activatedAt
-	subscription.ExpiresAt = activatedAt.Add(defaultExpiration)
+	subID, _ := primitive.ObjectIDFromHex(state.ID)
 
-	err = s.subscriptionsStore.Update(ctx, subscription)
+	var subscription *models.Subscription
+	err = store.RetryOnConflict(ctx, func() error {
+		return s.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+			user, err := s.usersStore.Get(ctx, userID)
+			if err != nil {
+				return err
+			}
+
+			subscription, err = s.subscriptionsStore.Get(ctx, subID)
+			if err != nil {
+				return err
+			}
+
+			if user.Balance < subscription.Price {
+				logging.FromContext(ctx).Info("insufficient funds", "user_id", state.UserID, "balance", user.Balance, "subscription_id", subscription.ID.Hex())
+				return ErrInsufficientFunds
+			}
+
+			user.Balance -= subscription.Price
+			user.UpdatedAt = time.Now()
+
+			err = s.usersStore.Update(ctx, user)
+			if err != nil {
+				return err
+			}
+
+			transaction := models.NewTransaction(user, models.TransactionCharge, -subscription.Price)
+			transaction.SubscriptionID = subscription.ID
+			err = s.transactionsStore.Create(ctx, transaction)
+			if err != nil {
+				return err
+			}
+
+			subscription.Activations++
+			activatedAt := time.Now()
+			subscription.ActivatedAt = activatedAt
+			subscription.ExpiresAt = activatedAt.Add(defaultExpiration)
+
+			err = s.subscriptionsStore.Update(ctx, subscription)
+			if err != nil {
+				return err
+			}
+
+			event := models.NewSubscriptionEvent(subscription, models.SubscriptionCharged, models.ActorSystem)
+			event.Amount = subscription.Price
+			event.RunID = state.RunID
+			return s.eventsStore.Create(ctx, event)
+		})
+	})
+	if errors.Is(err, ErrInsufficientFunds) {
+		// the transaction was rolled back, the failure is recorded on its own
+		event := models.NewSubscriptionEvent(subscription, models.SubscriptionRenewalFailed, models.ActorSystem)
+		event.Amount = subscription.Price
+		event.RunID = state.RunID
+		event.Reason = err.Error()
+		eventErr := s.eventsStore.Create(ctx, event)
+		if eventErr != nil {
+			return state, eventErr
+		}
+	}
 	if err != nil {
 		return state, err
 	}
@@ -174,28 +275,77 @@ func (s *service) Cancel(ctx context.Context, in *forms.CancelSubscriptionInput)
 	if err != nil {
 		return err
 	}
-	sub, err := s.subscriptionsStore.Get(ctx, subID)
-	if err != nil {
-		return err
-	}
-	if sub.UserID.Hex() != in.UserID {
-		return errors.New("cannot cancel subscription")
-	}
-	sub.Canceled = true
-	sub.CanceledAt = time.Now()
-	err = s.subscriptionsStore.Update(ctx, sub)
+
+	msg, err := bus.NewMessage(forms.CancelWorkflowInput{UserID: in.UserID, SubID: in.SubID})
 	if err != nil {
 		return err
 	}
-	return s.temporalClient.SignalWorkflow(ctx, subID.Hex(), "", SignalCancelSubscription, sub.Canceled)
+	msg.RequestID = logging.RequestID(ctx)
+
+	return store.RetryOnConflict(ctx, func() error {
+		sub, err := s.subscriptionsStore.Get(ctx, subID)
+		if err != nil {
+			return err
+		}
+		if sub.UserID.Hex() != in.UserID {
+			return ErrCannotCancel
+		}
+		sub.Canceled = true
+		sub.CanceledAt = time.Now()
+
+		// the workflow is signaled by the consumer of the outbox message, so
+		// the signal is sent if and only if the cancellation is stored
+		return s.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+			err := s.subscriptionsStore.Update(ctx, sub)
+			if err != nil {
+				return err
+			}
+			err = s.eventsStore.Create(ctx, models.NewSubscriptionEvent(sub, models.SubscriptionCanceled, in.UserID))
+			if err != nil {
+				return err
+			}
+			return s.outbox.Enqueue(ctx, Exchange, "", msg)
+		})
+	})
 }
 
+func (s *service) SignalCancel(ctx context.Context, in *forms.CancelWorkflowInput) error {
+	return s.temporalClient.SignalWorkflow(ctx, in.SubID, "", SignalCancelSubscription, true)
+}
+
+// Delete is called when the subscription lapsed without being renewed. The
+// document is kept, marked as deleted, so its history stays complete.
 func (s *service) Delete(ctx context.Context, state SubscriptionState) (SubscriptionState, error) {
 	subID, err := primitive.ObjectIDFromHex(state.ID)
 	if err != nil {
 		return state, err
 	}
-	err = s.subscriptionsStore.Delete(ctx, subID)
+	err = s.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		sub, err := s.subscriptionsStore.Get(ctx, subID)
+		if err != nil {
+			return err
+		}
+		if sub.Deleted {
+			// a retried activity, the events are already recorded
+			return nil
+		}
+
+		expired := models.NewSubscriptionEvent(sub, models.SubscriptionExpired, models.ActorSystem)
+		expired.RunID = state.RunID
+		err = s.eventsStore.Create(ctx, expired)
+		if err != nil {
+			return err
+		}
+
+		err = s.subscriptionsStore.Delete(ctx, subID)
+		if err != nil {
+			return err
+		}
+
+		deleted := models.NewSubscriptionEvent(sub, models.SubscriptionDeleted, models.ActorSystem)
+		deleted.RunID = state.RunID
+		return s.eventsStore.Create(ctx, deleted)
+	})
 	if err != nil {
 		return state, err
 	}
@@ -203,3 +353,40 @@ func (s *service) Delete(ctx context.Context, state SubscriptionState) (Subscrip
 	state.DeletedAt = time.Now().Unix()
 	return state, nil
 }
+
+// History returns the events of a subscription owned by userID, oldest first.
+func (s *service) History(ctx context.Context, userID, id string) ([]*forms.SubscriptionEventOutput, error) {
+	subID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := s.subscriptionsStore.Get(ctx, subID)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sub.UserID.Hex() != userID {
+		return nil, ErrNotFound
+	}
+
+	events, err := s.eventsStore.GetBySubscriptionID(ctx, subID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*forms.SubscriptionEventOutput, 0, len(events))
+	for _, event := range events {
+		out = append(out, &forms.SubscriptionEventOutput{
+			ID:         event.ID.Hex(),
+			Type:       event.Type,
+			Actor:      event.Actor,
+			Amount:     event.Amount,
+			WorkflowID: event.WorkflowID,
+			RunID:      event.RunID,
+			Reason:     event.Reason,
+			CreatedAt:  event.CreatedAt,
+		})
+	}
+	return out, nil
+}
@@ -3,17 +3,24 @@ package subscriptions
 import (
 	"go.temporal.io/sdk/client"
 	"go.temporal.io/sdk/worker"
-	"log"
+	"time"
 )
 
-func NewWorker(temporalClient client.Client, svc Service) {
-	w := worker.New(temporalClient, TaskQueueName, worker.Options{})
+// workerStopTimeout is how long Stop waits for running activities.
+const workerStopTimeout = 20 * time.Second
+
+// NewWorker starts polling the task queue. The caller stops the worker.
+func NewWorker(temporalClient client.Client, svc Service) (worker.Worker, error) {
+	w := worker.New(temporalClient, TaskQueueName, worker.Options{
+		WorkerStopTimeout: workerStopTimeout,
+	})
 
 	w.RegisterWorkflow(SubscriptionWorkflow)
 	w.RegisterActivity(&Activities{svc: svc})
 
-	err := w.Run(worker.InterruptCh())
+	err := w.Start()
 	if err != nil {
-		log.Panicln(err)
+		return nil, err
 	}
+	return w, nil
 }
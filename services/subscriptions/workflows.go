@@ -1,6 +1,8 @@
 package subscriptions
 
 import (
+	"go-temporal-workflow/logging"
+	"go.temporal.io/sdk/log"
 	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/workflow"
 	"strings"
@@ -15,6 +17,7 @@ const (
 
 type SubscriptionState struct {
 	ID          string
+	RunID       string
 	UserID      string
 	Type        string
 	Price       float64
@@ -31,9 +34,15 @@ func (s *SubscriptionState) HasExpired(t time.Time) bool {
 	return t.After(time.Unix(s.ExpiresAt, 0))
 }
 
+// cancelCoroutineChange versions the switch from draining the cancel signals
+// after each charge to receiving them in a coroutine.
+const cancelCoroutineChange = "cancel-coroutine"
+
 func SubscriptionWorkflow(ctx workflow.Context, state SubscriptionState, activities *Activities) (SubscriptionState, error) {
 
-	logger := workflow.GetLogger(ctx)
+	logger := logging.WorkflowLogger(ctx)
+
+	state.RunID = workflow.GetInfo(ctx).WorkflowExecution.RunID
 
 	err := workflow.SetQueryHandler(ctx, QuerySubscriptionState, func() (SubscriptionState, error) {
 		return state, nil
@@ -42,15 +51,6 @@ func SubscriptionWorkflow(ctx workflow.Context, state SubscriptionState, activit
 		return state, err
 	}
 
-	cancelSelector := workflow.NewSelector(ctx)
-	cancelCh := workflow.GetSignalChannel(ctx, SignalCancelSubscription)
-	cancelSelector.AddReceive(cancelCh, func(ch workflow.ReceiveChannel, _ bool) {
-		var cancelSignal bool
-		ch.Receive(ctx, &cancelSignal)
-		state.Canceled = cancelSignal
-		state.CanceledAt = time.Now().Unix()
-	})
-
 	ao := workflow.ActivityOptions{
 		StartToCloseTimeout: time.Second * 30,
 		RetryPolicy: &temporal.RetryPolicy{
@@ -61,25 +61,108 @@ func SubscriptionWorkflow(ctx workflow.Context, state SubscriptionState, activit
 
 	ctx = workflow.WithActivityOptions(ctx, ao)
 
+	// workflows started before the cancel coroutine drain the signals after
+	// each charge, their histories must replay with the same commands
+	version := workflow.GetVersion(ctx, cancelCoroutineChange, workflow.DefaultVersion, 1)
+	if version == workflow.DefaultVersion {
+		err = chargeUntilCanceledSelector(ctx, &state, activities, logger)
+	} else {
+		err = chargeUntilCanceled(ctx, &state, activities, logger)
+	}
+	if err != nil {
+		return state, err
+	}
+
+	if !state.Canceled {
+		err = workflow.ExecuteActivity(ctx, activities.Delete, state).Get(ctx, &state)
+		if err == nil {
+			logger.Info("subscription deleted", "id", state.ID, "user_id", state.UserID)
+		}
+	}
+
+	return state, err
+}
+
+// chargeUntilCanceled charges on every expiry until the subscription is
+// canceled or the user can't pay. Cancel signals are received in their own
+// coroutine so they interrupt the wait for the next charge instead of being
+// seen only after it.
+func chargeUntilCanceled(ctx workflow.Context, state *SubscriptionState, activities *Activities, logger log.Logger) error {
+	var canceled bool
+	var canceledAt int64
+	cancelCh := workflow.GetSignalChannel(ctx, SignalCancelSubscription)
+	workflow.Go(ctx, func(ctx workflow.Context) {
+		for {
+			var cancelSignal bool
+			cancelCh.Receive(ctx, &cancelSignal)
+			canceled = cancelSignal
+			canceledAt = workflow.Now(ctx).Unix()
+			state.Canceled = canceled
+			state.CanceledAt = canceledAt
+		}
+	})
+
 	for {
+		timeout := time.Unix(state.ExpiresAt, 0).Sub(time.Unix(state.ActivatedAt, 0))
+
+		_, err := workflow.AwaitWithTimeout(ctx, timeout, func() bool {
+			return canceled
+		})
+		if err != nil {
+			return err
+		}
+
+		if canceled {
+			logger.Info("subscription canceled", "id", state.ID, "user_id", state.UserID)
+			return nil
+		}
+
+		logger.Info("subscriptions expired", "user_id", state.UserID)
+
+		err = workflow.ExecuteActivity(ctx, activities.Charge, *state).Get(ctx, state)
+		state.Canceled = canceled
+		state.CanceledAt = canceledAt
+		if err != nil {
+			if strings.Contains(err.Error(), ErrInsufficientFunds.Error()) {
+				return nil
+			}
+			return err
+		}
+
+		logger.Info("subscription charged", "user_id", state.UserID)
+	}
+}
+
+// chargeUntilCanceledSelector is the loop of the workflows started before
+// the cancel coroutine. Keep it until none of them is running.
+func chargeUntilCanceledSelector(ctx workflow.Context, state *SubscriptionState, activities *Activities, logger log.Logger) error {
+	cancelSelector := workflow.NewSelector(ctx)
+	cancelCh := workflow.GetSignalChannel(ctx, SignalCancelSubscription)
+	cancelSelector.AddReceive(cancelCh, func(ch workflow.ReceiveChannel, _ bool) {
+		var cancelSignal bool
+		ch.Receive(ctx, &cancelSignal)
+		state.Canceled = cancelSignal
+		state.CanceledAt = time.Now().Unix()
+	})
 
+	for {
 		timeout := time.Unix(state.ExpiresAt, 0).Sub(time.Unix(state.ActivatedAt, 0))
 
-		_, err = workflow.AwaitWithTimeout(ctx, timeout, func() bool {
+		_, err := workflow.AwaitWithTimeout(ctx, timeout, func() bool {
 			return state.Canceled
 		})
 		if err != nil {
-			return state, err
+			return err
 		}
 
 		logger.Info("subscriptions expired", "user_id", state.UserID)
 
-		err = workflow.ExecuteActivity(ctx, activities.Charge, state).Get(ctx, &state)
+		err = workflow.ExecuteActivity(ctx, activities.Charge, *state).Get(ctx, state)
 		if err != nil {
 			if strings.Contains(err.Error(), ErrInsufficientFunds.Error()) {
-				break
+				return nil
 			}
-			return state, err
+			return err
 		}
 
 		logger.Info("subscription charged", "user_id", state.UserID)
@@ -90,16 +173,7 @@ func SubscriptionWorkflow(ctx workflow.Context, state SubscriptionState, activit
 
 		if state.Canceled {
 			logger.Info("subscription canceled", "id", state.ID, "user_id", state.UserID)
-			break
+			return nil
 		}
 	}
-
-	if !state.Canceled {
-		err = workflow.ExecuteActivity(ctx, activities.Delete, state).Get(ctx, &state)
-		if err == nil {
-			logger.Info("subscription deleted", "id", state.ID, "user_id", state.UserID)
-		}
-	}
-
-	return state, err
 }
@@ -0,0 +1,13 @@
+package users
+
+import "errors"
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrAccountSuspended   = errors.New("account suspended")
+	ErrTokenRevoked       = errors.New("token revoked")
+	ErrInvalidMFACode     = errors.New("invalid mfa code")
+	ErrMFAAlreadyEnabled  = errors.New("mfa already enabled")
+	ErrMFANotEnrolled     = errors.New("mfa not enrolled")
+	ErrMFANotEnabled      = errors.New("mfa not enabled")
+)
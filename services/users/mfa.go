@@ -0,0 +1,193 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"go-temporal-workflow/forms"
+	"go-temporal-workflow/models"
+	"go-temporal-workflow/security/secrets"
+	"go-temporal-workflow/security/tokens"
+	"go-temporal-workflow/security/totp"
+	"go-temporal-workflow/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const (
+	mfaIssuer         = "workflows"
+	recoveryCodeCount = 10
+)
+
+func (s *service) VerifyMFA(ctx context.Context, form *forms.MFAChallengeInput) (*forms.SignInOutput, error) {
+	payload, err := tokens.ParseChallenge(form.ChallengeToken)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.getUser(ctx, payload.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.MFAEnabled {
+		return nil, ErrMFANotEnabled
+	}
+	if user.Suspended {
+		return nil, ErrAccountSuspended
+	}
+	err = s.guard.Check(ctx, user.Email, form.IP)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.checkTOTP(user, form.Code)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		// the versioned update makes one of two concurrent uses of the
+		// same code fail
+		user.UpdatedAt = time.Now()
+		err = s.usersStore.Update(ctx, user)
+		if errors.Is(err, store.ErrConflict) {
+			ok = false
+		} else if err != nil {
+			return nil, err
+		}
+	} else {
+		ok, err = s.useRecoveryCode(ctx, user, form.Code)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !ok {
+		_ = s.failSignIn(ctx, user.Email, form.IP)
+		return nil, ErrInvalidMFACode
+	}
+	s.succeedSignIn(ctx, user.Email, form.IP)
+	token, err := tokens.New(user.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	return &forms.SignInOutput{Token: token}, nil
+}
+
+func (s *service) EnrollMFA(ctx context.Context, userID string) (*forms.MFAEnrollOutput, error) {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	user.MFASecret, err = secrets.Encrypt(secret)
+	if err != nil {
+		return nil, err
+	}
+	user.UpdatedAt = time.Now()
+	err = s.usersStore.Update(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	return &forms.MFAEnrollOutput{
+		Secret: secret,
+		URI:    totp.ProvisioningURI(secret, mfaIssuer, user.Email),
+	}, nil
+}
+
+func (s *service) ActivateMFA(ctx context.Context, form *forms.MFACodeInput) (*forms.MFAActivateOutput, error) {
+	user, err := s.getUser(ctx, form.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	ok, err := s.checkTOTP(user, form.Code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+	codes, err := totp.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	user.RecoveryCodes = make([]string, 0, len(codes))
+	for _, code := range codes {
+		user.RecoveryCodes = append(user.RecoveryCodes, secrets.Digest(code))
+	}
+	user.MFAEnabled = true
+	user.UpdatedAt = time.Now()
+	err = s.usersStore.Update(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	return &forms.MFAActivateOutput{RecoveryCodes: codes}, nil
+}
+
+func (s *service) DisableMFA(ctx context.Context, form *forms.MFACodeInput) error {
+	user, err := s.getUser(ctx, form.UserID)
+	if err != nil {
+		return err
+	}
+	if !user.MFAEnabled {
+		return ErrMFANotEnabled
+	}
+	ok, err := s.checkTOTP(user, form.Code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	user.MFAEnabled = false
+	user.MFASecret = ""
+	user.MFALastStep = 0
+	user.RecoveryCodes = nil
+	user.UpdatedAt = time.Now()
+	return s.usersStore.Update(ctx, user)
+}
+
+func (s *service) getUser(ctx context.Context, id string) (*models.User, error) {
+	userID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.usersStore.Get(ctx, userID)
+}
+
+// checkTOTP rejects codes of a time step that was already accepted, so an
+// intercepted code can't be replayed. On success it records the step on
+// user, the caller has to save it.
+func (s *service) checkTOTP(user *models.User, code string) (bool, error) {
+	if user.MFASecret == "" {
+		return false, ErrMFANotEnrolled
+	}
+	secret, err := secrets.Decrypt(user.MFASecret)
+	if err != nil {
+		return false, err
+	}
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok || step <= user.MFALastStep {
+		return false, nil
+	}
+	user.MFALastStep = step
+	return true, nil
+}
+
+// useRecoveryCode consumes the matching recovery code, so each one can only
+// be used once.
+func (s *service) useRecoveryCode(ctx context.Context, user *models.User, code string) (bool, error) {
+	for index, hash := range user.RecoveryCodes {
+		if !secrets.DigestEqual(hash, code) {
+			continue
+		}
+		user.RecoveryCodes = append(user.RecoveryCodes[:index], user.RecoveryCodes[index+1:]...)
+		user.UpdatedAt = time.Now()
+		return true, s.usersStore.Update(ctx, user)
+	}
+	return false, nil
+}
@@ -4,39 +4,78 @@ import (
 	"context"
 	"fmt"
 	"go-temporal-workflow/forms"
+	"go-temporal-workflow/logging"
 	"go-temporal-workflow/models"
+	"go-temporal-workflow/security/lockout"
 	"go-temporal-workflow/security/passwords"
 	"go-temporal-workflow/security/tokens"
 	"go-temporal-workflow/store"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"sync"
 	"time"
 )
 
 type Service interface {
 	SignUp(ctx context.Context, in *forms.SignUpInput) error
 	SignIn(ctx context.Context, in *forms.SignInInput) (*forms.SignInOutput, error)
+	VerifyMFA(ctx context.Context, in *forms.MFAChallengeInput) (*forms.SignInOutput, error)
+	EnrollMFA(ctx context.Context, userID string) (*forms.MFAEnrollOutput, error)
+	ActivateMFA(ctx context.Context, in *forms.MFACodeInput) (*forms.MFAActivateOutput, error)
+	DisableMFA(ctx context.Context, in *forms.MFACodeInput) error
 	GetUser(ctx context.Context, id string) (*forms.UserOutput, error)
 	Deposit(ctx context.Context, in *forms.DepositInput) (*forms.UserOutput, error)
+	Authenticate(ctx context.Context, token string) (*tokens.TokenPayload, error)
 }
 
 type service struct {
-	usersStore store.UsersStore
+	usersStore        store.UsersStore
+	transactionsStore store.TransactionsStore
+	passwordPolicy    *passwords.Policy
+	guard             lockout.Guard
 }
 
-func NewService(usersStore store.UsersStore) Service {
-	return &service{usersStore: usersStore}
+func NewService(usersStore store.UsersStore, transactionsStore store.TransactionsStore, passwordPolicy *passwords.Policy, guard lockout.Guard) Service {
+	return &service{
+		usersStore:        usersStore,
+		transactionsStore: transactionsStore,
+		passwordPolicy:    passwordPolicy,
+		guard:             guard,
+	}
 }
 
 func (s *service) SignIn(ctx context.Context, form *forms.SignInInput) (*forms.SignInOutput, error) {
+	err := s.guard.Check(ctx, form.Email, form.IP)
+	if err != nil {
+		return nil, err
+	}
 	user, err := s.usersStore.GetByEmail(ctx, form.Email)
+	if err == mongo.ErrNoDocuments {
+		// verify against a dummy hash so unknown emails take as long as wrong passwords
+		_ = passwords.OK(dummyHash(), form.Password)
+		return nil, s.failSignIn(ctx, form.Email, form.IP)
+	}
 	if err != nil {
 		return nil, err
 	}
 	err = passwords.OK(user.Password, form.Password)
 	if err != nil {
-		return nil, err
+		return nil, s.failSignIn(ctx, form.Email, form.IP)
 	}
+	if user.Suspended {
+		return nil, ErrAccountSuspended
+	}
+	if passwords.NeedsRehash(user.Password) {
+		s.rehash(ctx, user, form.Password)
+	}
+	if user.MFAEnabled {
+		challenge, err := tokens.NewChallenge(user.ID.Hex())
+		if err != nil {
+			return nil, err
+		}
+		return &forms.SignInOutput{MFARequired: true, ChallengeToken: challenge}, nil
+	}
+	s.succeedSignIn(ctx, user.Email, form.IP)
 	token, err := tokens.New(user.ID.Hex())
 	if err != nil {
 		return nil, err
@@ -44,19 +83,72 @@ func (s *service) SignIn(ctx context.Context, form *forms.SignInInput) (*forms.S
 	return &forms.SignInOutput{Token: token}, nil
 }
 
+var (
+	dummyHashOnce  sync.Once
+	dummyHashValue string
+)
+
+func dummyHash() string {
+	dummyHashOnce.Do(func() {
+		dummyHashValue, _ = passwords.New("dummy password")
+	})
+	return dummyHashValue
+}
+
+func (s *service) failSignIn(ctx context.Context, email, ip string) error {
+	err := s.guard.Fail(ctx, email, ip)
+	if err != nil {
+		logging.FromContext(ctx).Error("error on track failed sign in", "email", email, "err", err)
+	}
+	return ErrInvalidCredentials
+}
+
+func (s *service) succeedSignIn(ctx context.Context, email, ip string) {
+	err := s.guard.Succeed(ctx, email, ip)
+	if err != nil {
+		logging.FromContext(ctx).Error("error on reset failed sign ins", "email", email, "err", err)
+	}
+}
+
+// rehash upgrades the stored hash to the current algorithm. Failures are
+// only logged, the sign in has already succeeded.
+func (s *service) rehash(ctx context.Context, user *models.User, password string) {
+	hash, err := passwords.New(password)
+	if err != nil {
+		logging.FromContext(ctx).Error("error on rehash password", "user_id", user.ID.Hex(), "err", err)
+		return
+	}
+	user.Password = hash
+	user.UpdatedAt = time.Now()
+	err = s.usersStore.Update(ctx, user)
+	if err != nil {
+		logging.FromContext(ctx).Error("error on rehash password", "user_id", user.ID.Hex(), "err", err)
+	}
+}
+
 func (s *service) SignUp(ctx context.Context, form *forms.SignUpInput) error {
+	err := s.passwordPolicy.Validate(form.Password, form.Email)
+	if err != nil {
+		return err
+	}
 	exists, err := s.usersStore.GetByEmail(ctx, form.Email)
 	if err == mongo.ErrNoDocuments {
 		var user models.User
 		user.ID = primitive.NewObjectID()
 		user.Email = form.Email
+		user.Role = models.RoleUser
 		user.Password, err = passwords.New(form.Password)
 		if err != nil {
 			return err
 		}
 		user.CreatedAt = time.Now()
 		user.UpdatedAt = time.Now()
-		return s.usersStore.Create(ctx, &user)
+		err = s.usersStore.Create(ctx, &user)
+		if mongo.IsDuplicateKeyError(err) {
+			// a concurrent signup won the race on the unique email index
+			return fmt.Errorf("%s already registered", form.Email)
+		}
+		return err
 	}
 	if err == nil || exists != nil {
 		return fmt.Errorf("%s already registered", form.Email)
@@ -74,13 +166,15 @@ func (s *service) GetUser(ctx context.Context, id string) (*forms.UserOutput, er
 		return nil, err
 	}
 	return &forms.UserOutput{
-		ID:        user.ID.Hex(),
-		Email:     user.Email,
-		Password:  user.Password,
-		Balance:   user.Balance,
-		Role:      user.Role,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
+		ID:         user.ID.Hex(),
+		Email:      user.Email,
+		Password:   user.Password,
+		Balance:    user.Balance,
+		Role:       user.Role,
+		MFAEnabled: user.MFAEnabled,
+		Suspended:  user.Suspended,
+		CreatedAt:  user.CreatedAt,
+		UpdatedAt:  user.UpdatedAt,
 	}, nil
 }
 
@@ -89,23 +183,59 @@ func (s *service) Deposit(ctx context.Context, form *forms.DepositInput) (*forms
 	if err != nil {
 		return nil, err
 	}
-	user, err := s.usersStore.Get(ctx, userID)
+	var user *models.User
+	err = store.RetryOnConflict(ctx, func() error {
+		user, err = s.usersStore.Get(ctx, userID)
+		if err != nil {
+			return err
+		}
+		user.Balance += form.Amount
+		user.UpdatedAt = time.Now()
+		return s.usersStore.Update(ctx, user)
+	})
 	if err != nil {
 		return nil, err
 	}
-	user.Balance += form.Amount
-	user.UpdatedAt = time.Now()
-	err = s.usersStore.Update(ctx, user)
+	err = s.transactionsStore.Create(ctx, models.NewTransaction(user, models.TransactionDeposit, form.Amount))
 	if err != nil {
 		return nil, err
 	}
 	return &forms.UserOutput{
-		ID:        user.ID.Hex(),
-		Email:     user.Email,
-		Password:  user.Password,
-		Balance:   user.Balance,
-		Role:      user.Role,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
+		ID:         user.ID.Hex(),
+		Email:      user.Email,
+		Password:   user.Password,
+		Balance:    user.Balance,
+		Role:       user.Role,
+		MFAEnabled: user.MFAEnabled,
+		Suspended:  user.Suspended,
+		CreatedAt:  user.CreatedAt,
+		UpdatedAt:  user.UpdatedAt,
 	}, nil
-}
\ No newline at end of file
+}
+
+// revoked reports whether the token was issued before the last revocation.
+// Tokens carry whole seconds, so one issued in the second of the revocation
+// counts as revoked.
+func revoked(payload *tokens.TokenPayload, user *models.User) bool {
+	if user.RevokedAt.IsZero() {
+		return false
+	}
+	return !payload.IssuedAt.After(user.RevokedAt.Truncate(time.Second))
+}
+
+// Authenticate parses the access token and checks that it still belongs to
+// an active account and was issued after the last token revocation.
+func (s *service) Authenticate(ctx context.Context, token string) (*tokens.TokenPayload, error) {
+	payload, err := tokens.Parse(token)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.getUser(ctx, payload.UserID)
+	if err != nil {
+		return nil, ErrTokenRevoked
+	}
+	if user.Deleted || user.Suspended || revoked(payload, user) {
+		return nil, ErrTokenRevoked
+	}
+	return payload, nil
+}
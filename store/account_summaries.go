@@ -0,0 +1,44 @@
+package store
+
+import (
+	"context"
+	"go-temporal-workflow/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AccountSummariesStore interface {
+	Put(ctx context.Context, summary *models.AccountSummary) error
+	Get(ctx context.Context, userID primitive.ObjectID) (*models.AccountSummary, error)
+	Delete(ctx context.Context, userID primitive.ObjectID) error
+}
+
+type accountSummariesStore struct {
+	conn *mongo.Collection
+}
+
+func NewAccountSummariesStore(conn *mongo.Database) AccountSummariesStore {
+	return &accountSummariesStore{conn: conn.Collection("account_summaries")}
+}
+
+// Put replaces the whole summary, so fields that no longer apply are removed.
+func (s *accountSummariesStore) Put(ctx context.Context, summary *models.AccountSummary) error {
+	_, err := s.conn.ReplaceOne(ctx, bson.M{"_id": summary.UserID}, summary, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *accountSummariesStore) Get(ctx context.Context, userID primitive.ObjectID) (*models.AccountSummary, error) {
+	var summary models.AccountSummary
+	err := s.conn.FindOne(ctx, bson.M{"_id": userID}).Decode(&summary)
+	if err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+func (s *accountSummariesStore) Delete(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.conn.DeleteOne(ctx, bson.M{"_id": userID})
+	return err
+}
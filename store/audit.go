@@ -0,0 +1,49 @@
+package store
+
+import (
+	"context"
+	"go-temporal-workflow/logging"
+	"go-temporal-workflow/models"
+	"go-temporal-workflow/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AuditStore interface {
+	Create(ctx context.Context, entry *models.AuditEntry) error
+	GetByTargetID(ctx context.Context, targetID primitive.ObjectID) ([]*models.AuditEntry, error)
+}
+
+type auditStore struct {
+	conn *mongo.Collection
+}
+
+func NewAuditStore(conn *mongo.Database) AuditStore {
+	return &auditStore{conn: conn.Collection("audit")}
+}
+
+func (s *auditStore) Create(ctx context.Context, entry *models.AuditEntry) error {
+	_, err := s.conn.InsertOne(ctx, entry)
+	if err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Debug("audit entry created", "id", entry.ID.Hex())
+	return nil
+}
+
+func (s *auditStore) GetByTargetID(ctx context.Context, targetID primitive.ObjectID) ([]*models.AuditEntry, error) {
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	cursor, err := s.conn.Find(ctx, bson.M{"target_id": targetID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer utils.HandleCloseContext(ctx, cursor)
+	var entries []*models.AuditEntry
+	err = cursor.All(ctx, &entries)
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
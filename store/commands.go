@@ -0,0 +1,53 @@
+package store
+
+import (
+	"context"
+	"go-temporal-workflow/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+type CommandsStore interface {
+	Create(ctx context.Context, command *models.Command) error
+	Get(ctx context.Context, id string) (*models.Command, error)
+	SetStatus(ctx context.Context, id, status, workflowID, cause string) error
+}
+
+type commandsStore struct {
+	conn *mongo.Collection
+}
+
+func NewCommandsStore(conn *mongo.Database) CommandsStore {
+	return &commandsStore{conn: conn.Collection("commands")}
+}
+
+func (s *commandsStore) Create(ctx context.Context, command *models.Command) error {
+	_, err := s.conn.InsertOne(ctx, command)
+	return err
+}
+
+func (s *commandsStore) Get(ctx context.Context, id string) (*models.Command, error) {
+	var command models.Command
+	err := s.conn.FindOne(ctx, bson.M{"_id": id}).Decode(&command)
+	if err != nil {
+		return nil, err
+	}
+	return &command, nil
+}
+
+// SetStatus never changes a command that already succeeded or failed, so a
+// redelivered message can't overwrite the outcome.
+func (s *commandsStore) SetStatus(ctx context.Context, id, status, workflowID, cause string) error {
+	filter := bson.M{"_id": id, "status": models.CommandPending}
+	update := bson.M{
+		"$set": bson.M{
+			"status":      status,
+			"workflow_id": workflowID,
+			"error":       cause,
+			"updated_at":  time.Now(),
+		},
+	}
+	_, err := s.conn.UpdateOne(ctx, filter, update)
+	return err
+}
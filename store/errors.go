@@ -0,0 +1,7 @@
+package store
+
+import "errors"
+
+var (
+	ErrConflict = errors.New("document was modified concurrently")
+)
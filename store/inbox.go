@@ -0,0 +1,47 @@
+package store
+
+import (
+	"context"
+	"go-temporal-workflow/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+type InboxStore interface {
+	Seen(ctx context.Context, consumer, messageID string) (bool, error)
+	Record(ctx context.Context, consumer, messageID string) error
+}
+
+type inboxStore struct {
+	conn *mongo.Collection
+}
+
+func NewInboxStore(conn *mongo.Database) InboxStore {
+	return &inboxStore{conn: conn.Collection("inbox")}
+}
+
+func inboxID(consumer, messageID string) string {
+	return consumer + ":" + messageID
+}
+
+func (s *inboxStore) Seen(ctx context.Context, consumer, messageID string) (bool, error) {
+	n, err := s.conn.CountDocuments(ctx, bson.M{"_id": inboxID(consumer, messageID)})
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *inboxStore) Record(ctx context.Context, consumer, messageID string) error {
+	_, err := s.conn.InsertOne(ctx, &models.InboxEntry{
+		ID:        inboxID(consumer, messageID),
+		Consumer:  consumer,
+		MessageID: messageID,
+		HandledAt: time.Now(),
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
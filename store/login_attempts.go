@@ -0,0 +1,171 @@
+package store
+
+import (
+	"context"
+	"go-temporal-workflow/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sync"
+	"time"
+)
+
+// LoginAttemptsStore counts sign in attempts per key. Attempt counts one
+// unless the key is locked, in a single update, and returns the key as it was
+// before. The count is kept until expiresAt, extended by every attempt.
+type LoginAttemptsStore interface {
+	Get(ctx context.Context, key string) (*models.LoginAttempt, error)
+	Attempt(ctx context.Context, key string, at, expiresAt time.Time) (*models.LoginAttempt, error)
+	Release(ctx context.Context, key string) error
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+type loginAttemptsStore struct {
+	conn *mongo.Collection
+}
+
+func NewLoginAttemptsStore(conn *mongo.Database) LoginAttemptsStore {
+	return &loginAttemptsStore{conn: conn.Collection("login_attempts")}
+}
+
+func (s *loginAttemptsStore) Get(ctx context.Context, key string) (*models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	err := s.conn.FindOne(ctx, bson.M{"_id": key}).Decode(&attempt)
+	if err == mongo.ErrNoDocuments {
+		return &models.LoginAttempt{Key: key}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// Attempt only matches an unlocked key. A locked one makes the upsert insert
+// a duplicate _id, which is read back to return its lock. Two first attempts
+// of a key race the same way, so the update runs once more.
+func (s *loginAttemptsStore) Attempt(ctx context.Context, key string, at, expiresAt time.Time) (*models.LoginAttempt, error) {
+	filter := bson.M{
+		"_id":          key,
+		"locked_until": bson.M{"$not": bson.M{"$gt": at}},
+	}
+	update := bson.M{
+		"$inc": bson.M{"failures": 1},
+		"$set": bson.M{"last_failure_at": at},
+		"$max": bson.M{"expires_at": expiresAt},
+	}
+	opts := options.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(options.Before)
+
+	for i := 0; ; i++ {
+		var attempt models.LoginAttempt
+		err := s.conn.FindOneAndUpdate(ctx, filter, update, opts).Decode(&attempt)
+		if err == nil {
+			return &attempt, nil
+		}
+		if err == mongo.ErrNoDocuments {
+			// inserted
+			return &models.LoginAttempt{Key: key}, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+		locked, err := s.Get(ctx, key)
+		if err != nil || at.Before(locked.LockedUntil) || i > 0 {
+			return locked, err
+		}
+	}
+}
+
+// Release takes back an attempt that succeeded.
+func (s *loginAttemptsStore) Release(ctx context.Context, key string) error {
+	filter := bson.M{"_id": key, "failures": bson.M{"$gt": 0}}
+	_, err := s.conn.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"failures": -1}})
+	return err
+}
+
+func (s *loginAttemptsStore) Lock(ctx context.Context, key string, until time.Time) error {
+	update := bson.M{
+		"$set": bson.M{"locked_until": until},
+		"$max": bson.M{"expires_at": until},
+	}
+	_, err := s.conn.UpdateOne(ctx, bson.M{"_id": key}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (s *loginAttemptsStore) Reset(ctx context.Context, key string) error {
+	_, err := s.conn.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+type memoryLoginAttemptsStore struct {
+	mu       sync.Mutex
+	attempts map[string]models.LoginAttempt
+}
+
+func NewMemoryLoginAttemptsStore() LoginAttemptsStore {
+	return &memoryLoginAttemptsStore{attempts: make(map[string]models.LoginAttempt)}
+}
+
+func (s *memoryLoginAttemptsStore) Get(_ context.Context, key string) (*models.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempt, ok := s.attempts[key]
+	if !ok {
+		attempt.Key = key
+	}
+	return &attempt, nil
+}
+
+func (s *memoryLoginAttemptsStore) Attempt(_ context.Context, key string, at, expiresAt time.Time) (*models.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempt, ok := s.attempts[key]
+	if ok && !at.Before(attempt.ExpiresAt) {
+		attempt = models.LoginAttempt{}
+	}
+	attempt.Key = key
+	before := attempt
+	if at.Before(attempt.LockedUntil) {
+		return &before, nil
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = at
+	if expiresAt.After(attempt.ExpiresAt) {
+		attempt.ExpiresAt = expiresAt
+	}
+	s.attempts[key] = attempt
+	return &before, nil
+}
+
+func (s *memoryLoginAttemptsStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempt, ok := s.attempts[key]
+	if ok && attempt.Failures > 0 {
+		attempt.Failures--
+		s.attempts[key] = attempt
+	}
+	return nil
+}
+
+func (s *memoryLoginAttemptsStore) Lock(_ context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempt := s.attempts[key]
+	attempt.Key = key
+	attempt.LockedUntil = until
+	if until.After(attempt.ExpiresAt) {
+		attempt.ExpiresAt = until
+	}
+	s.attempts[key] = attempt
+	return nil
+}
+
+func (s *memoryLoginAttemptsStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"go-temporal-workflow/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Migrations are the schema changes of the collections owned by the stores.
+// Append new ones with the next version, never edit released ones.
+var Migrations = []db.Migration{
+	{
+		Version: 1,
+		Name:    "users_email_unique",
+		Up:      db.CreateIndex("users", "email_unique", bson.D{{Key: "email", Value: 1}}, true),
+		Down:    db.DropIndex("users", "email_unique"),
+	},
+	{
+		Version: 2,
+		Name:    "subscriptions_user_id",
+		Up:      db.CreateIndex("subscriptions", "user_id", bson.D{{Key: "user_id", Value: 1}}, false),
+		Down:    db.DropIndex("subscriptions", "user_id"),
+	},
+	{
+		Version: 3,
+		Name:    "subscriptions_expires_at",
+		Up:      db.CreateIndex("subscriptions", "expires_at", bson.D{{Key: "expires_at", Value: 1}}, false),
+		Down:    db.DropIndex("subscriptions", "expires_at"),
+	},
+	{
+		Version: 4,
+		Name:    "transactions_user_id_created_at",
+		Up:      db.CreateIndex("transactions", "user_id_created_at", bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}}, false),
+		Down:    db.DropIndex("transactions", "user_id_created_at"),
+	},
+	{
+		Version: 5,
+		Name:    "outbox_pending",
+		// the relay claims pending entries, operators list the failed ones
+		// oldest first
+		Up: steps(
+			db.CreateIndex("outbox", "status_locked_until_created_at", bson.D{{Key: "status", Value: 1}, {Key: "locked_until", Value: 1}, {Key: "created_at", Value: 1}}, false),
+			db.CreateIndex("outbox", "status_created_at", bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}}, false),
+		),
+		Down: steps(
+			db.DropIndex("outbox", "status_locked_until_created_at"),
+			db.DropIndex("outbox", "status_created_at"),
+		),
+	},
+	{
+		Version: 6,
+		Name:    "users_subscriptions_version",
+		Up:      backfillVersion("users", "subscriptions"),
+		Down:    dropVersion("users", "subscriptions"),
+	},
+	{
+		Version: 7,
+		Name:    "subscription_events_subscription_id_created_at",
+		Up:      db.CreateIndex("subscription_events", "subscription_id_created_at", bson.D{{Key: "subscription_id", Value: 1}, {Key: "created_at", Value: 1}}, false),
+		Down:    db.DropIndex("subscription_events", "subscription_id_created_at"),
+	},
+	{
+		Version: 8,
+		Name:    "login_attempts_expires_at",
+		Up:      db.CreateTTLIndex("login_attempts", "expires_at_ttl", "expires_at"),
+		Down:    db.DropIndex("login_attempts", "expires_at_ttl"),
+	},
+}
+
+// steps runs the migration steps in order.
+func steps(fns ...func(ctx context.Context, database *mongo.Database) error) func(ctx context.Context, database *mongo.Database) error {
+	return func(ctx context.Context, database *mongo.Database) error {
+		for _, fn := range fns {
+			err := fn(ctx, database)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// backfillVersion sets version 0 on the documents written before updates
+// were versioned, so the conditional updates match them.
+func backfillVersion(collections ...string) func(ctx context.Context, database *mongo.Database) error {
+	return func(ctx context.Context, database *mongo.Database) error {
+		for _, collection := range collections {
+			_, err := database.Collection(collection).UpdateMany(ctx,
+				bson.M{"version": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"version": 0}},
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func dropVersion(collections ...string) func(ctx context.Context, database *mongo.Database) error {
+	return func(ctx context.Context, database *mongo.Database) error {
+		for _, collection := range collections {
+			_, err := database.Collection(collection).UpdateMany(ctx,
+				bson.M{},
+				bson.M{"$unset": bson.M{"version": ""}},
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"go-temporal-workflow/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+type OutboxStore interface {
+	Create(ctx context.Context, entry *models.OutboxEntry) error
+	Claim(ctx context.Context, lease time.Duration) (*models.OutboxEntry, error)
+	MarkSent(ctx context.Context, id primitive.ObjectID) error
+	MarkRetry(ctx context.Context, id primitive.ObjectID, cause error) error
+	MarkFailed(ctx context.Context, id primitive.ObjectID, cause error) error
+}
+
+type outboxStore struct {
+	conn *mongo.Collection
+}
+
+func NewOutboxStore(conn *mongo.Database) OutboxStore {
+	return &outboxStore{conn: conn.Collection("outbox")}
+}
+
+func (s *outboxStore) Create(ctx context.Context, entry *models.OutboxEntry) error {
+	_, err := s.conn.InsertOne(ctx, entry)
+	return err
+}
+
+// Claim locks the oldest pending entry for lease and returns it, or nil when
+// there is nothing to publish. An entry whose relay died is claimed again
+// once its lease expires.
+func (s *outboxStore) Claim(ctx context.Context, lease time.Duration) (*models.OutboxEntry, error) {
+	now := time.Now()
+	filter := bson.M{
+		"status":       models.OutboxPending,
+		"locked_until": bson.M{"$lte": now},
+	}
+	update := bson.M{"$set": bson.M{"locked_until": now.Add(lease)}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.M{"created_at": 1}).
+		SetReturnDocument(options.After)
+
+	var entry models.OutboxEntry
+	err := s.conn.FindOneAndUpdate(ctx, filter, update, opts).Decode(&entry)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (s *outboxStore) MarkSent(ctx context.Context, id primitive.ObjectID) error {
+	update := bson.M{
+		"$set": bson.M{"status": models.OutboxSent, "sent_at": time.Now()},
+		"$inc": bson.M{"attempts": 1},
+	}
+	_, err := s.conn.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// MarkRetry records the error and keeps the entry locked until its lease
+// expires, which delays the next attempt.
+func (s *outboxStore) MarkRetry(ctx context.Context, id primitive.ObjectID, cause error) error {
+	update := bson.M{
+		"$set": bson.M{"last_error": cause.Error()},
+		"$inc": bson.M{"attempts": 1},
+	}
+	_, err := s.conn.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// MarkFailed records the error and takes the entry out of the pending ones
+// for good.
+func (s *outboxStore) MarkFailed(ctx context.Context, id primitive.ObjectID, cause error) error {
+	update := bson.M{
+		"$set": bson.M{"status": models.OutboxFailed, "last_error": cause.Error()},
+		"$inc": bson.M{"attempts": 1},
+	}
+	_, err := s.conn.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"context"
+	"go-temporal-workflow/logging"
+	"go-temporal-workflow/models"
+	"go-temporal-workflow/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SubscriptionEventsStore is append-only, events are never updated or
+// deleted.
+type SubscriptionEventsStore interface {
+	Create(ctx context.Context, event *models.SubscriptionEvent) error
+	GetBySubscriptionID(ctx context.Context, subscriptionID primitive.ObjectID) ([]*models.SubscriptionEvent, error)
+}
+
+type subscriptionEventsStore struct {
+	conn *mongo.Collection
+}
+
+func NewSubscriptionEventsStore(conn *mongo.Database) SubscriptionEventsStore {
+	return &subscriptionEventsStore{conn: conn.Collection("subscription_events")}
+}
+
+func (s *subscriptionEventsStore) Create(ctx context.Context, event *models.SubscriptionEvent) error {
+	_, err := s.conn.InsertOne(ctx, event)
+	if err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Debug("subscription event created", "id", event.ID.Hex())
+	return nil
+}
+
+func (s *subscriptionEventsStore) GetBySubscriptionID(ctx context.Context, subscriptionID primitive.ObjectID) ([]*models.SubscriptionEvent, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := s.conn.Find(ctx, bson.M{"subscription_id": subscriptionID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer utils.HandleCloseContext(ctx, cursor)
+	var events []*models.SubscriptionEvent
+	err = cursor.All(ctx, &events)
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
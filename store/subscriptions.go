@@ -2,12 +2,13 @@ package store
 
 import (
 	"context"
+	"go-temporal-workflow/logging"
 	"go-temporal-workflow/models"
 	"go-temporal-workflow/utils"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"log"
+	"time"
 )
 
 type SubscriptionsStore interface {
@@ -28,33 +29,34 @@ func NewSubscriptionsStore(conn *mongo.Database) SubscriptionsStore {
 }
 
 func (s *subscriptionsStore) Create(ctx context.Context, subscription *models.Subscription) error {
-	result, err := s.conn.InsertOne(ctx, subscription)
+	_, err := s.conn.InsertOne(ctx, subscription)
 	if err != nil {
 		return err
 	}
-	log.Println("subscription created: ", result)
+	logging.FromContext(ctx).Debug("subscription created", "id", subscription.ID.Hex())
 	return nil
 }
 
 func (s *subscriptionsStore) Update(ctx context.Context, subscription *models.Subscription) error {
 
-	update := bson.M{
-		"$set": bson.M{
-			"type":         subscription.Type,
-			"price":        subscription.Price,
-			"activations":  subscription.Activations,
-			"activated_at": subscription.ActivatedAt,
-			"expires_at":   subscription.ExpiresAt,
-		},
+	set := bson.M{
+		"type":         subscription.Type,
+		"price":        subscription.Price,
+		"canceled":     subscription.Canceled,
+		"activations":  subscription.Activations,
+		"activated_at": subscription.ActivatedAt,
+		"expires_at":   subscription.ExpiresAt,
+		"canceled_at":  subscription.CanceledAt,
+		"deleted":      subscription.Deleted,
+		"deleted_at":   subscription.DeletedAt,
 	}
 
-	filter := bson.M{"_id": bson.M{"$eq": subscription.ID}}
-
-	result, err := s.conn.UpdateOne(ctx, filter, update)
+	_, err := updateVersion(ctx, s.conn, subscription.ID, subscription.Version, set)
 	if err != nil {
 		return err
 	}
-	log.Println("subscription updated: ", result)
+	subscription.Version++
+	logging.FromContext(ctx).Debug("subscription updated", "id", subscription.ID.Hex(), "version", subscription.Version)
 	return nil
 }
 
@@ -68,7 +70,7 @@ func (s *subscriptionsStore) Get(ctx context.Context, id primitive.ObjectID) (*m
 }
 
 func (s *subscriptionsStore) GetByUserID(ctx context.Context, userID primitive.ObjectID) ([]*models.Subscription, error) {
-	cursor, err := s.conn.Find(ctx, bson.M{"user_id": userID})
+	cursor, err := s.conn.Find(ctx, bson.M{"user_id": userID, "deleted": bson.M{"$ne": true}})
 	if err != nil {
 		return nil, err
 	}
@@ -83,7 +85,7 @@ func (s *subscriptionsStore) GetByUserID(ctx context.Context, userID primitive.O
 
 func (s *subscriptionsStore) GetAll(ctx context.Context) ([]*models.Subscription, error) {
 	var subscriptions []*models.Subscription
-	cursor, err := s.conn.Find(ctx, bson.M{})
+	cursor, err := s.conn.Find(ctx, bson.M{"deleted": bson.M{"$ne": true}})
 	if err != nil {
 		return nil, err
 	}
@@ -95,11 +97,23 @@ func (s *subscriptionsStore) GetAll(ctx context.Context) ([]*models.Subscription
 	return subscriptions, nil
 }
 
+// Delete marks the subscription as deleted. It stays readable with Get so its
+// history can still be shown, GetByUserID and GetAll skip it.
 func (s *subscriptionsStore) Delete(ctx context.Context, id primitive.ObjectID) error {
-	result, err := s.conn.DeleteOne(ctx, bson.M{"_id": id})
+	update := bson.M{
+		"$set": bson.M{
+			"deleted":    true,
+			"deleted_at": time.Now(),
+		},
+		"$inc": bson.M{"version": 1},
+	}
+	result, err := s.conn.UpdateOne(ctx, bson.M{"_id": id}, update)
 	if err != nil {
 		return err
 	}
-	log.Println("subscription deleted: ", result)
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	logging.FromContext(ctx).Debug("subscription deleted", "id", id.Hex())
 	return nil
 }
@@ -0,0 +1,49 @@
+package store
+
+import (
+	"context"
+	"go-temporal-workflow/logging"
+	"go-temporal-workflow/models"
+	"go-temporal-workflow/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type TransactionsStore interface {
+	Create(ctx context.Context, transaction *models.Transaction) error
+	GetByUserID(ctx context.Context, userID primitive.ObjectID) ([]*models.Transaction, error)
+}
+
+type transactionsStore struct {
+	conn *mongo.Collection
+}
+
+func NewTransactionsStore(conn *mongo.Database) TransactionsStore {
+	return &transactionsStore{conn: conn.Collection("transactions")}
+}
+
+func (s *transactionsStore) Create(ctx context.Context, transaction *models.Transaction) error {
+	_, err := s.conn.InsertOne(ctx, transaction)
+	if err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Debug("transaction created", "id", transaction.ID.Hex())
+	return nil
+}
+
+func (s *transactionsStore) GetByUserID(ctx context.Context, userID primitive.ObjectID) ([]*models.Transaction, error) {
+	opts := options.Find().SetSort(bson.M{"created_at": 1})
+	cursor, err := s.conn.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer utils.HandleCloseContext(ctx, cursor)
+	var transactions []*models.Transaction
+	err = cursor.All(ctx, &transactions)
+	if err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
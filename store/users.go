@@ -2,12 +2,14 @@ package store
 
 import (
 	"context"
+	"go-temporal-workflow/logging"
+	"go-temporal-workflow/models"
+	"go-temporal-workflow/utils"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"log"
-	"go-temporal-workflow/models"
-	"go-temporal-workflow/utils"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
 )
 
 type UsersStore interface {
@@ -15,10 +17,28 @@ type UsersStore interface {
 	Update(ctx context.Context, user *models.User) error
 	Get(ctx context.Context, id primitive.ObjectID) (*models.User, error)
 	GetByEmail(ctx context.Context, email string) (*models.User, error)
-	GetAll(ctx context.Context) ([]*models.User, error)
+	GetAll(ctx context.Context, query *UsersQuery) ([]*models.User, error)
+	ForEach(ctx context.Context, fn func(user *models.User) error) error
+	Count(ctx context.Context, query *UsersQuery) (int64, error)
 	Delete(ctx context.Context, id primitive.ObjectID) error
 }
 
+// UsersQuery filters GetAll and Count. Email matches any part of the
+// address, case insensitive. A zero Limit returns every match.
+type UsersQuery struct {
+	Email string
+	Skip  int64
+	Limit int64
+}
+
+func (q *UsersQuery) filter() bson.M {
+	filter := bson.M{}
+	if q != nil && q.Email != "" {
+		filter["email"] = primitive.Regex{Pattern: regexp.QuoteMeta(q.Email), Options: "i"}
+	}
+	return filter
+}
+
 type usersStore struct {
 	conn *mongo.Collection
 }
@@ -28,33 +48,42 @@ func NewUsersStore(conn *mongo.Database) UsersStore {
 }
 
 func (s *usersStore) Create(ctx context.Context, user *models.User) error {
-	result, err := s.conn.InsertOne(ctx, user)
+	_, err := s.conn.InsertOne(ctx, user)
 	if err != nil {
 		return err
 	}
-	log.Println("user created: ", result)
+	logging.FromContext(ctx).Debug("user created", "id", user.ID.Hex())
 	return nil
 }
 
+// Update writes the user only if nobody else updated it since it was read,
+// otherwise it returns ErrConflict. On success user.Version is bumped.
 func (s *usersStore) Update(ctx context.Context, user *models.User) error {
 
-	update := bson.M{
-		"$set": bson.M{
-			"email":      user.Email,
-			"password":   user.Password,
-			"balance":    user.Balance,
-			"role":       user.Role,
-			"updated_at": user.UpdatedAt,
-		},
+	set := bson.M{
+		"email":          user.Email,
+		"password":       user.Password,
+		"balance":        user.Balance,
+		"role":           user.Role,
+		"mfa_enabled":    user.MFAEnabled,
+		"mfa_secret":     user.MFASecret,
+		"mfa_last_step":  user.MFALastStep,
+		"recovery_codes": user.RecoveryCodes,
+		"suspended":      user.Suspended,
+		"suspended_at":   user.SuspendedAt,
+		"deleting":       user.Deleting,
+		"deleted":        user.Deleted,
+		"deleted_at":     user.DeletedAt,
+		"revoked_at":     user.RevokedAt,
+		"updated_at":     user.UpdatedAt,
 	}
 
-	filter := bson.M{"_id": bson.M{"$eq": user.ID}}
-
-	result, err := s.conn.UpdateOne(ctx, filter, update)
+	_, err := updateVersion(ctx, s.conn, user.ID, user.Version, set)
 	if err != nil {
 		return err
 	}
-	log.Println("user updated: ", result)
+	user.Version++
+	logging.FromContext(ctx).Debug("user updated", "id", user.ID.Hex(), "version", user.Version)
 	return nil
 }
 
@@ -76,9 +105,16 @@ func (s *usersStore) GetByEmail(ctx context.Context, email string) (*models.User
 	return &user, nil
 }
 
-func (s *usersStore) GetAll(ctx context.Context) ([]*models.User, error) {
+func (s *usersStore) GetAll(ctx context.Context, query *UsersQuery) ([]*models.User, error) {
+	opts := options.Find().SetSort(bson.M{"created_at": 1})
+	if query != nil {
+		opts.SetSkip(query.Skip)
+		if query.Limit > 0 {
+			opts.SetLimit(query.Limit)
+		}
+	}
 	var users []*models.User
-	cursor, err := s.conn.Find(ctx, bson.M{})
+	cursor, err := s.conn.Find(ctx, query.filter(), opts)
 	if err != nil {
 		return nil, err
 	}
@@ -90,12 +126,38 @@ func (s *usersStore) GetAll(ctx context.Context) ([]*models.User, error) {
 	return users, nil
 }
 
+// ForEach calls fn with every user, read in batches from a cursor instead of
+// loaded at once. It stops at the first error of fn.
+func (s *usersStore) ForEach(ctx context.Context, fn func(user *models.User) error) error {
+	opts := options.Find().SetSort(bson.M{"_id": 1}).SetBatchSize(500)
+	cursor, err := s.conn.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return err
+	}
+	defer utils.HandleCloseContext(ctx, cursor)
+	for cursor.Next(ctx) {
+		var user models.User
+		err = cursor.Decode(&user)
+		if err != nil {
+			return err
+		}
+		err = fn(&user)
+		if err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func (s *usersStore) Count(ctx context.Context, query *UsersQuery) (int64, error) {
+	return s.conn.CountDocuments(ctx, query.filter())
+}
 
 func (s *usersStore) Delete(ctx context.Context, id primitive.ObjectID) error {
 	result, err := s.conn.DeleteOne(ctx, bson.M{"_id": id})
 	if err != nil {
 		return err
 	}
-	log.Println("user deleted: ", result)
+	logging.FromContext(ctx).Debug("user deleted", "id", id.Hex(), "deleted", result.DeletedCount)
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"go-temporal-workflow/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// conflictAttempts is how many times RetryOnConflict runs fn.
+const conflictAttempts = 3
+
+// RetryOnConflict runs fn again while it fails with ErrConflict. fn must read
+// the document again on every run, otherwise it keeps writing a stale copy.
+func RetryOnConflict(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 1; attempt <= conflictAttempts; attempt++ {
+		err = fn()
+		if !errors.Is(err, ErrConflict) || ctx.Err() != nil {
+			return err
+		}
+		logging.FromContext(ctx).Warn("version conflict, retrying", "attempt", attempt)
+	}
+	return err
+}
+
+// updateVersion sets the fields only when the stored version is still the
+// one that was read, and bumps it. It tells a conflict apart from a missing
+// document. Documents written before versioning read as version 0, so they
+// match too until the backfill migration ran.
+func updateVersion(ctx context.Context, conn *mongo.Collection, id primitive.ObjectID, version int64, set bson.M) (*mongo.UpdateResult, error) {
+	filter := bson.M{"_id": id, "version": version}
+	if version == 0 {
+		filter = bson.M{"_id": id, "$or": bson.A{
+			bson.M{"version": 0},
+			bson.M{"version": bson.M{"$exists": false}},
+		}}
+	}
+	update := bson.M{
+		"$set": set,
+		"$inc": bson.M{"version": 1},
+	}
+	result, err := conn.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		n, err := conn.CountDocuments(ctx, bson.M{"_id": id})
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, mongo.ErrNoDocuments
+		}
+		return nil, ErrConflict
+	}
+	return result, nil
+}
@@ -0,0 +1,64 @@
+package temporalclient
+
+import (
+	"context"
+	"errors"
+	"go-temporal-workflow/logging"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/client"
+)
+
+// New connects to Temporal. When the config asks for it, the namespace is
+// registered first if it doesn't exist yet.
+func New(ctx context.Context, cfg Config) (client.Client, error) {
+	opts, err := cfg.ClientOptions()
+	if err != nil {
+		return nil, err
+	}
+	err = EnsureNamespace(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return client.NewClient(opts)
+}
+
+// EnsureNamespace checks that the namespace exists. A missing namespace is
+// registered when RegisterNamespace is set and reported otherwise, so a
+// typo fails at startup instead of on the first workflow.
+func EnsureNamespace(ctx context.Context, cfg Config) error {
+	opts, err := cfg.ClientOptions()
+	if err != nil {
+		return err
+	}
+	namespaces, err := client.NewNamespaceClient(opts)
+	if err != nil {
+		return err
+	}
+	defer namespaces.Close()
+
+	_, err = namespaces.Describe(ctx, cfg.Namespace())
+	var notFound *serviceerror.NotFound
+	if !errors.As(err, &notFound) {
+		return err
+	}
+	if !cfg.RegisterNamespace() {
+		return ErrNamespaceNotFound
+	}
+
+	retention := cfg.NamespaceRetention()
+	err = namespaces.Register(ctx, &workflowservice.RegisterNamespaceRequest{
+		Namespace:                        cfg.Namespace(),
+		WorkflowExecutionRetentionPeriod: &retention,
+	})
+	var exists *serviceerror.NamespaceAlreadyExists
+	if errors.As(err, &exists) {
+		// another process registered it first
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	logging.Default().Info("temporal namespace registered", "namespace", cfg.Namespace())
+	return nil
+}
@@ -0,0 +1,239 @@
+package temporalclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/sdk/converter"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	encodingEncrypted  = "binary/encrypted"
+	encodingGzip       = "binary/gzip"
+	metadataKeyID      = "encryption-key-id"
+	defaultCompressMin = 256
+)
+
+// PayloadCodec transforms payloads after the data converter serialized them
+// and before it deserializes them. Decode leaves payloads it didn't encode
+// untouched, so histories written before a codec was added stay readable.
+type PayloadCodec interface {
+	Encode(payloads []*commonpb.Payload) ([]*commonpb.Payload, error)
+	Decode(payloads []*commonpb.Payload) ([]*commonpb.Payload, error)
+}
+
+// ChainCodecs encodes with the codecs in order and decodes in reverse.
+func ChainCodecs(codecs ...PayloadCodec) PayloadCodec {
+	return chain(codecs)
+}
+
+type chain []PayloadCodec
+
+func (c chain) Encode(payloads []*commonpb.Payload) ([]*commonpb.Payload, error) {
+	var err error
+	for _, codec := range c {
+		payloads, err = codec.Encode(payloads)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return payloads, nil
+}
+
+func (c chain) Decode(payloads []*commonpb.Payload) ([]*commonpb.Payload, error) {
+	var err error
+	for i := len(c) - 1; i >= 0; i-- {
+		payloads, err = c[i].Decode(payloads)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return payloads, nil
+}
+
+// ParseKeys reads keys written as id:base64key pairs separated by commas.
+func ParseKeys(s string) (map[string][]byte, error) {
+	keys := make(map[string][]byte)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, ErrInvalidKeyFormat
+		}
+		key, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", parts[0], err)
+		}
+		if _, ok := keys[parts[0]]; ok {
+			return nil, fmt.Errorf("key %s: %w", parts[0], ErrDuplicateKeyID)
+		}
+		keys[parts[0]] = key
+	}
+	return keys, nil
+}
+
+// encryptionCodec seals payloads with AES-GCM. Every payload records the ID
+// of the key it was sealed with, so keys can be rotated by adding a new one
+// as the active key and keeping the old ones for decoding.
+type encryptionCodec struct {
+	keyID string
+	aeads map[string]cipher.AEAD
+}
+
+// NewEncryptionCodec encrypts with the key keyID. The other keys are only
+// used to decrypt. Keys must be 16, 24 or 32 bytes long.
+func NewEncryptionCodec(keys map[string][]byte, keyID string) (PayloadCodec, error) {
+	if _, ok := keys[keyID]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKeyID, keyID)
+	}
+	codec := &encryptionCodec{keyID: keyID, aeads: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		codec.aeads[id] = aead
+	}
+	return codec, nil
+}
+
+func (c *encryptionCodec) Encode(payloads []*commonpb.Payload) ([]*commonpb.Payload, error) {
+	aead := c.aeads[c.keyID]
+	out := make([]*commonpb.Payload, len(payloads))
+	for i, p := range payloads {
+		if p == nil {
+			continue
+		}
+		plain, err := p.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		nonce := make([]byte, aead.NonceSize())
+		_, err = io.ReadFull(rand.Reader, nonce)
+		if err != nil {
+			return nil, err
+		}
+		// the key ID is authenticated so it can't be swapped for another key
+		out[i] = &commonpb.Payload{
+			Metadata: map[string][]byte{
+				converter.MetadataEncoding: []byte(encodingEncrypted),
+				metadataKeyID:              []byte(c.keyID),
+			},
+			Data: aead.Seal(nonce, nonce, plain, []byte(c.keyID)),
+		}
+	}
+	return out, nil
+}
+
+func (c *encryptionCodec) Decode(payloads []*commonpb.Payload) ([]*commonpb.Payload, error) {
+	out := make([]*commonpb.Payload, len(payloads))
+	for i, p := range payloads {
+		if p == nil || string(p.Metadata[converter.MetadataEncoding]) != encodingEncrypted {
+			out[i] = p
+			continue
+		}
+		keyID := string(p.Metadata[metadataKeyID])
+		aead, ok := c.aeads[keyID]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownKeyID, keyID)
+		}
+		if len(p.Data) < aead.NonceSize() {
+			return nil, ErrDecrypt
+		}
+		nonce, sealed := p.Data[:aead.NonceSize()], p.Data[aead.NonceSize():]
+		plain, err := aead.Open(nil, nonce, sealed, []byte(keyID))
+		if err != nil {
+			return nil, ErrDecrypt
+		}
+		out[i] = new(commonpb.Payload)
+		err = out[i].Unmarshal(plain)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// compressionCodec gzips payloads of at least minSize bytes. Smaller ones
+// rarely shrink and are passed through. With minSize below zero it only
+// decodes.
+type compressionCodec struct {
+	minSize int
+}
+
+// NewCompressionCodec compresses payloads of at least minSize bytes, 256 when
+// minSize is zero. A negative minSize disables compression but still
+// decompresses, for payloads written while it was enabled.
+func NewCompressionCodec(minSize int) PayloadCodec {
+	if minSize == 0 {
+		minSize = defaultCompressMin
+	}
+	return &compressionCodec{minSize: minSize}
+}
+
+func (c *compressionCodec) Encode(payloads []*commonpb.Payload) ([]*commonpb.Payload, error) {
+	out := make([]*commonpb.Payload, len(payloads))
+	for i, p := range payloads {
+		if p == nil || c.minSize < 0 || p.Size() < c.minSize {
+			out[i] = p
+			continue
+		}
+		plain, err := p.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		_, err = w.Write(plain)
+		if err == nil {
+			err = w.Close()
+		}
+		if err != nil {
+			return nil, err
+		}
+		out[i] = &commonpb.Payload{
+			Metadata: map[string][]byte{converter.MetadataEncoding: []byte(encodingGzip)},
+			Data:     buf.Bytes(),
+		}
+	}
+	return out, nil
+}
+
+func (c *compressionCodec) Decode(payloads []*commonpb.Payload) ([]*commonpb.Payload, error) {
+	out := make([]*commonpb.Payload, len(payloads))
+	for i, p := range payloads {
+		if p == nil || string(p.Metadata[converter.MetadataEncoding]) != encodingGzip {
+			out[i] = p
+			continue
+		}
+		r, err := gzip.NewReader(bytes.NewReader(p.Data))
+		if err != nil {
+			return nil, err
+		}
+		plain, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = new(commonpb.Payload)
+		err = out[i].Unmarshal(plain)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
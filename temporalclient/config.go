@@ -0,0 +1,177 @@
+package temporalclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"go-temporal-workflow/logging"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/workflow"
+	"io/ioutil"
+	"time"
+)
+
+const defaultNamespaceRetention = 72 * time.Hour
+
+// ConnectionOptions describe how to reach the Temporal frontend. Setting a
+// certificate and key enables mTLS, as Temporal Cloud requires.
+type ConnectionOptions struct {
+	HostPort  string
+	Namespace string
+	Identity  string
+
+	TLS           bool
+	TLSCAFile     string
+	TLSCertFile   string
+	TLSKeyFile    string
+	TLSServerName string
+	TLSInsecure   bool
+
+	// RegisterNamespace registers Namespace on startup when it is missing,
+	// with NamespaceRetention as the workflow retention period.
+	RegisterNamespace  bool
+	NamespaceRetention time.Duration
+
+	LogLevel string
+
+	// EncryptionKeys are id:base64key pairs, see ParseKeys. When set,
+	// payloads are encrypted with EncryptionKeyID before they reach the
+	// server. Compress gzips them first.
+	EncryptionKeys  string
+	EncryptionKeyID string
+	Compress        bool
+
+	// DataConverter replaces the SDK default converter. The codec still
+	// applies on top of it.
+	DataConverter converter.DataConverter
+}
+
+type Config interface {
+	ClientOptions() (client.Options, error)
+	Codec() (PayloadCodec, error)
+	Namespace() string
+	RegisterNamespace() bool
+	NamespaceRetention() time.Duration
+}
+
+type config struct {
+	opts ConnectionOptions
+}
+
+func NewConfig(opts *ConnectionOptions) Config {
+	cfg := &config{opts: *opts}
+	if cfg.opts.HostPort == "" {
+		cfg.opts.HostPort = client.DefaultHostPort
+	}
+	if cfg.opts.Namespace == "" {
+		cfg.opts.Namespace = client.DefaultNamespace
+	}
+	if cfg.opts.NamespaceRetention <= 0 {
+		cfg.opts.NamespaceRetention = defaultNamespaceRetention
+	}
+	return cfg
+}
+
+func (cfg *config) Namespace() string {
+	return cfg.opts.Namespace
+}
+
+func (cfg *config) RegisterNamespace() bool {
+	return cfg.opts.RegisterNamespace
+}
+
+func (cfg *config) NamespaceRetention() time.Duration {
+	return cfg.opts.NamespaceRetention
+}
+
+func (cfg *config) ClientOptions() (client.Options, error) {
+	level := logging.LevelInfo
+	if cfg.opts.LogLevel != "" {
+		var err error
+		level, err = logging.ParseLevel(cfg.opts.LogLevel)
+		if err != nil {
+			return client.Options{}, err
+		}
+	}
+	opts := client.Options{
+		HostPort:  cfg.opts.HostPort,
+		Namespace: cfg.opts.Namespace,
+		Identity:  cfg.opts.Identity,
+		Logger:    logging.NewTemporalLogger(logging.Default(), level),
+		// the request ID follows workflows into their activities
+		ContextPropagators: []workflow.ContextPropagator{logging.NewContextPropagator()},
+	}
+	codec, err := cfg.Codec()
+	if err != nil {
+		return client.Options{}, err
+	}
+	dataConverter := cfg.opts.DataConverter
+	if dataConverter == nil {
+		dataConverter = converter.GetDefaultDataConverter()
+	}
+	opts.DataConverter = NewCodecDataConverter(dataConverter, codec)
+	if cfg.tlsEnabled() {
+		tlsConfig, err := cfg.tlsConfig()
+		if err != nil {
+			return client.Options{}, err
+		}
+		opts.ConnectionOptions.TLS = tlsConfig
+	}
+	return opts, nil
+}
+
+// Codec returns the payload codec. Compressed payloads are decoded even with
+// Compress off, so turning it off doesn't break running workflows.
+func (cfg *config) Codec() (PayloadCodec, error) {
+	compression := NewCompressionCodec(-1)
+	if cfg.opts.Compress {
+		compression = NewCompressionCodec(0)
+	}
+	codecs := []PayloadCodec{compression}
+	if cfg.opts.EncryptionKeys != "" {
+		keys, err := ParseKeys(cfg.opts.EncryptionKeys)
+		if err != nil {
+			return nil, err
+		}
+		encryption, err := NewEncryptionCodec(keys, cfg.opts.EncryptionKeyID)
+		if err != nil {
+			return nil, err
+		}
+		codecs = append(codecs, encryption)
+	}
+	return ChainCodecs(codecs...), nil
+}
+
+func (cfg *config) tlsEnabled() bool {
+	return cfg.opts.TLS || cfg.opts.TLSCAFile != "" || cfg.opts.TLSCertFile != "" || cfg.opts.TLSKeyFile != ""
+}
+
+func (cfg *config) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.opts.TLSServerName,
+		InsecureSkipVerify: cfg.opts.TLSInsecure,
+	}
+	if cfg.opts.TLSCAFile != "" {
+		pem, err := ioutil.ReadFile(cfg.opts.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, ErrInvalidTLSCA
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if (cfg.opts.TLSCertFile == "") != (cfg.opts.TLSKeyFile == "") {
+		return nil, ErrTLSKeyPair
+	}
+	if cfg.opts.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.opts.TLSCertFile, cfg.opts.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,81 @@
+package temporalclient
+
+import (
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/sdk/converter"
+)
+
+type codecDataConverter struct {
+	parent converter.DataConverter
+	codec  PayloadCodec
+}
+
+// NewCodecDataConverter runs the payloads of parent through codec.
+func NewCodecDataConverter(parent converter.DataConverter, codec PayloadCodec) converter.DataConverter {
+	return &codecDataConverter{parent: parent, codec: codec}
+}
+
+func (c *codecDataConverter) ToPayload(value interface{}) (*commonpb.Payload, error) {
+	payload, err := c.parent.ToPayload(value)
+	if err != nil || payload == nil {
+		return payload, err
+	}
+	encoded, err := c.codec.Encode([]*commonpb.Payload{payload})
+	if err != nil {
+		return nil, err
+	}
+	return encoded[0], nil
+}
+
+func (c *codecDataConverter) FromPayload(payload *commonpb.Payload, valuePtr interface{}) error {
+	if payload == nil {
+		return c.parent.FromPayload(payload, valuePtr)
+	}
+	decoded, err := c.codec.Decode([]*commonpb.Payload{payload})
+	if err != nil {
+		return err
+	}
+	return c.parent.FromPayload(decoded[0], valuePtr)
+}
+
+func (c *codecDataConverter) ToPayloads(values ...interface{}) (*commonpb.Payloads, error) {
+	payloads, err := c.parent.ToPayloads(values...)
+	if err != nil || payloads == nil {
+		return payloads, err
+	}
+	encoded, err := c.codec.Encode(payloads.Payloads)
+	if err != nil {
+		return nil, err
+	}
+	return &commonpb.Payloads{Payloads: encoded}, nil
+}
+
+func (c *codecDataConverter) FromPayloads(payloads *commonpb.Payloads, valuePtrs ...interface{}) error {
+	if payloads == nil {
+		return c.parent.FromPayloads(payloads, valuePtrs...)
+	}
+	decoded, err := c.codec.Decode(payloads.Payloads)
+	if err != nil {
+		return err
+	}
+	return c.parent.FromPayloads(&commonpb.Payloads{Payloads: decoded}, valuePtrs...)
+}
+
+func (c *codecDataConverter) ToString(payload *commonpb.Payload) string {
+	decoded, err := c.codec.Decode([]*commonpb.Payload{payload})
+	if err != nil {
+		return "<" + err.Error() + ">"
+	}
+	return c.parent.ToString(decoded[0])
+}
+
+func (c *codecDataConverter) ToStrings(payloads *commonpb.Payloads) []string {
+	if payloads == nil {
+		return nil
+	}
+	out := make([]string, len(payloads.Payloads))
+	for i, payload := range payloads.Payloads {
+		out[i] = c.ToString(payload)
+	}
+	return out
+}
@@ -0,0 +1,13 @@
+package temporalclient
+
+import "errors"
+
+var (
+	ErrInvalidTLSCA      = errors.New("no certificate found in tls ca file")
+	ErrTLSKeyPair        = errors.New("tls cert file and tls key file must be set together")
+	ErrNamespaceNotFound = errors.New("temporal namespace not found")
+	ErrInvalidKeyFormat  = errors.New("encryption keys must be id:base64key pairs")
+	ErrDuplicateKeyID    = errors.New("duplicate encryption key id")
+	ErrUnknownKeyID      = errors.New("unknown encryption key id")
+	ErrDecrypt           = errors.New("payload decryption failed")
+)
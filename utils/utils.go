@@ -2,8 +2,9 @@ package utils
 
 import (
 	"context"
+	"fmt"
+	"go-temporal-workflow/logging"
 	"io"
-	"log"
 	"path/filepath"
 	"runtime"
 )
@@ -21,7 +22,7 @@ func HandleCloseContext(ctx context.Context, closer CloserContext) {
 	if closer != nil {
 		err := closer.Close(ctx)
 		if err != nil {
-			log.Printf("error on close %T: %s\n", closer, err)
+			logging.FromContext(ctx).Error("error on close", "closer", fmt.Sprintf("%T", closer), "err", err)
 		}
 	}
 }
@@ -30,7 +31,7 @@ func HandleClose(closer io.Closer) {
 	if closer != nil {
 		err := closer.Close()
 		if err != nil {
-			log.Printf("error on close %T: %s\n", closer, err)
+			logging.Default().Error("error on close", "closer", fmt.Sprintf("%T", closer), "err", err)
 		}
 	}
 }
\ No newline at end of file